@@ -0,0 +1,365 @@
+package matrixsearch
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// AutoIndexer builds keys from the text-tagged fields of item. A tag of "-" skips the
+// field. Options after the name, as in `text:"city,fold,trim"`, name normalizers
+// applied to the value: lower, upper, trim, fold, nfc and nfkc. Nested structs are
+// traversed; when the struct field itself is tagged, its tag and a dot are prepended to
+// the nested keys, e.g. manufacturer.name:Tesla. Slices and arrays produce one key per
+// distinct element and maps one key per entry, named tag.mapkey and ordered by map key;
+// a ':' or '\' in the map key is escaped as by Escape.
+// Each of these keys takes part in the combinations of the item like any other, so every
+// element doubles the composite keys of the item; index large collections with
+// WithCombinations or a HashIndex instead. Nil
+// pointers are skipped, and so is a pointer back to a struct that is already being
+// visited, so cyclic values end.
+//
+// Numeric fields accept bucket=0:75:150 and step=5, which add a key such as
+// speed.bucket:75-150 next to the raw value; noraw drops the raw value. extract=name
+// runs the Extractor registered under name and indexes its results under name.
+//
+// Times are indexed as Unix seconds and durations as seconds, so both work with range
+// queries. The options year, month, day and hour add UTC bucket keys such as
+// lastseen.day:2026-10-18 to a time field.
+//
+// The fields to visit are compiled into a plan the first time a type is seen and
+// cached, so struct tags are only parsed once per type.
+func AutoIndexer[T any](item T) []string {
+	v := indirect(reflect.ValueOf(item))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	plan := planFor(v.Type())
+	w := walker{}
+	if v.CanAddr() {
+		w.path = []visit{{v.UnsafeAddr(), v.Type()}}
+	}
+	return plan.appendKeys(make([]string, 0, plan.size), w, v)
+}
+
+// indexPlan lists the fields of a struct type that produce keys, together with a
+// compiled emitter for each of them.
+type indexPlan struct {
+	fields []fieldPlan
+	// size is the number of keys produced when every field yields exactly one key. It is
+	// used to size the key slice up front.
+	size int
+}
+
+type fieldPlan struct {
+	index int
+	emit  emitter
+}
+
+// emitter appends the keys of a field value to keys. Key names are compiled relative to
+// the enclosing struct and prefixed with w.prefix when emitted.
+type emitter func(keys []string, w walker, v reflect.Value) []string
+
+// walker carries the state of one AutoIndexer call through the emitters.
+type walker struct {
+	// prefix is the tag path of the struct being visited, e.g. "manufacturer.".
+	prefix string
+	// path holds the structs reached through pointers on the way to the current one.
+	path []visit
+}
+
+// visit identifies a struct by its address and type; a struct and its first field
+// share an address.
+type visit struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+// plans caches an *indexPlan per struct type.
+var plans sync.Map
+
+func planFor(t reflect.Type) *indexPlan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*indexPlan)
+	}
+	p, _ := plans.LoadOrStore(t, compilePlan(t))
+	return p.(*indexPlan)
+}
+
+func (p *indexPlan) appendKeys(keys []string, w walker, v reflect.Value) []string {
+	for i := range p.fields {
+		f := &p.fields[i]
+		keys = f.emit(keys, w, v.Field(f.index))
+	}
+	return keys
+}
+
+func compilePlan(t reflect.Type) *indexPlan {
+	p := &indexPlan{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, opts := parseTag(field.Tag.Get("text"))
+		if tag == "-" {
+			continue
+		}
+		ft, ptrs := derefType(field.Type)
+		if ft == timeType {
+			if tag != "" {
+				emit, n := timeEmitter(tag, opts)
+				p.size += n
+				p.addField(i, emit, derivedEmitter(field.Type, tag, parseDerived(opts)))
+			}
+			continue
+		}
+		if ft.Kind() == reflect.Struct {
+			if ptrs == 0 {
+				sub := planFor(ft)
+				p.size += sub.size
+				p.fields = append(p.fields, fieldPlan{index: i, emit: nestedEmitter(tag, sub.appendKeys)})
+			} else {
+				p.fields = append(p.fields, fieldPlan{index: i, emit: nestedEmitter(tag, lazyStructEmitter(ft))})
+			}
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+		d := parseDerived(opts)
+		var raw emitter
+		if !d.noRaw {
+			raw = valueEmitter(field.Type, tag, tagNormalizers(opts))
+		}
+		derived := derivedEmitter(field.Type, tag, d)
+		if raw != nil {
+			p.size++
+		}
+		if derived != nil {
+			p.size++
+		}
+		p.addField(i, raw, derived)
+	}
+	return p
+}
+
+// addField adds field index to the plan with the non-nil emitters in emits, run in order.
+func (p *indexPlan) addField(index int, emits ...emitter) {
+	var fns []emitter
+	for _, emit := range emits {
+		if emit != nil {
+			fns = append(fns, emit)
+		}
+	}
+	switch len(fns) {
+	case 0:
+		return
+	case 1:
+		p.fields = append(p.fields, fieldPlan{index: index, emit: fns[0]})
+	default:
+		p.fields = append(p.fields, fieldPlan{index: index, emit: func(keys []string, w walker, v reflect.Value) []string {
+			for _, emit := range fns {
+				keys = emit(keys, w, v)
+			}
+			return keys
+		}})
+	}
+}
+
+// nestedEmitter runs emit on a nested struct. When the struct field is tagged, its tag
+// and a dot are added to the prefix of the nested keys.
+func nestedEmitter(tag string, emit emitter) emitter {
+	if tag == "" {
+		return emit
+	}
+	tag += "."
+	return func(keys []string, w walker, v reflect.Value) []string {
+		w.prefix += tag
+		return emit(keys, w, v)
+	}
+}
+
+// lazyStructEmitter traverses a struct reached through pointers. Its plan is only
+// compiled once a non-nil value is seen, which keeps self-referencing types finite, and
+// a struct already on w.path is skipped, which keeps cyclic values finite.
+func lazyStructEmitter(t reflect.Type) emitter {
+	var once sync.Once
+	var plan *indexPlan
+	return func(keys []string, w walker, v reflect.Value) []string {
+		if v = indirect(v); !v.IsValid() {
+			return keys
+		}
+		here := visit{v.UnsafeAddr(), t}
+		for _, seen := range w.path {
+			if seen == here {
+				return keys
+			}
+		}
+		w.path = append(w.path, here)
+		once.Do(func() { plan = planFor(t) })
+		return plan.appendKeys(keys, w, v)
+	}
+}
+
+// maxLinearDedupe is the collection length up to which repeated elements are found by
+// scanning the keys already emitted rather than with a set.
+const maxLinearDedupe = 16
+
+// valueEmitter returns the emitter for a tagged non-struct field of type t, or nil if
+// values of t cannot be turned into keys. Values are passed through fns.
+func valueEmitter(t reflect.Type, name string, fns []Normalizer) emitter {
+	t, ptrs := derefType(t)
+	prefix := name + ":"
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		elem, _ := derefType(t.Elem())
+		format := normalizedFormatter(elem, fns)
+		if format == nil {
+			return nil
+		}
+		return func(keys []string, w walker, v reflect.Value) []string {
+			if v = indirect(v); !v.IsValid() {
+				return keys
+			}
+			start := len(keys)
+			var seen map[string]struct{}
+			if v.Len() > maxLinearDedupe {
+				seen = make(map[string]struct{}, v.Len())
+			}
+		next:
+			for i := 0; i < v.Len(); i++ {
+				e := indirect(v.Index(i))
+				if !e.IsValid() {
+					continue
+				}
+				s := format(e)
+				if s == "" {
+					continue
+				}
+				key := w.prefix + prefix + s
+				// Repeated elements would put the item in the same posting list twice.
+				if seen != nil {
+					if _, dup := seen[key]; dup {
+						continue
+					}
+					seen[key] = struct{}{}
+				} else {
+					for _, k := range keys[start:] {
+						if k == key {
+							continue next
+						}
+					}
+				}
+				keys = append(keys, key)
+			}
+			return keys
+		}
+	case reflect.Map:
+		elem, _ := derefType(t.Elem())
+		formatKey, format := formatterFor(t.Key()), normalizedFormatter(elem, fns)
+		if formatKey == nil || format == nil {
+			return nil
+		}
+		return func(keys []string, w walker, v reflect.Value) []string {
+			if v = indirect(v); !v.IsValid() {
+				return keys
+			}
+			entries := make(map[string]string, v.Len())
+			names := make([]string, 0, v.Len())
+			iter := v.MapRange()
+			for iter.Next() {
+				e := indirect(iter.Value())
+				if !e.IsValid() {
+					continue
+				}
+				entryName, s := formatKey(iter.Key()), format(e)
+				if _, dup := entries[entryName]; entryName != "" && s != "" && !dup {
+					entries[entryName] = s
+					names = append(names, entryName)
+				}
+			}
+			sort.Strings(names)
+			for _, entryName := range names {
+				keys = append(keys, w.prefix+name+"."+Escape(entryName)+":"+entries[entryName])
+			}
+			return keys
+		}
+	}
+	format := normalizedFormatter(t, fns)
+	if format == nil {
+		return nil
+	}
+	if ptrs == 0 {
+		return func(keys []string, w walker, v reflect.Value) []string {
+			if s := format(v); s != "" {
+				keys = append(keys, w.prefix+prefix+s)
+			}
+			return keys
+		}
+	}
+	return func(keys []string, w walker, v reflect.Value) []string {
+		if v = indirect(v); !v.IsValid() {
+			return keys
+		}
+		if s := format(v); s != "" {
+			keys = append(keys, w.prefix+prefix+s)
+		}
+		return keys
+	}
+}
+
+// formatterFor returns the function that renders values of type t as key values, or
+// nil if t is not supported.
+func formatterFor(t reflect.Type) func(reflect.Value) string {
+	switch t {
+	case timeType:
+		return formatTime
+	case durationType:
+		return formatDuration
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.Value.String
+	case reflect.Bool:
+		return func(v reflect.Value) string { return strconv.FormatBool(v.Bool()) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) string { return strconv.FormatInt(v.Int(), 10) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) string { return strconv.FormatUint(v.Uint(), 10) }
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value) string { return strconv.FormatFloat(v.Float(), 'f', -1, 64) }
+	}
+	return nil
+}
+
+// normalizedFormatter is formatterFor with fns applied to the result.
+func normalizedFormatter(t reflect.Type, fns []Normalizer) func(reflect.Value) string {
+	format := formatterFor(t)
+	if format == nil || len(fns) == 0 {
+		return format
+	}
+	return func(v reflect.Value) string {
+		return normalize(fns, format(v))
+	}
+}
+
+// derefType strips pointer types from t and reports how many were removed.
+func derefType(t reflect.Type) (reflect.Type, int) {
+	n := 0
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		n++
+	}
+	return t, n
+}
+
+// indirect follows pointers until it reaches a non-pointer value. It returns the zero
+// Value if a nil pointer is encountered.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,197 @@
+package matrixsearch
+
+// OpKind identifies the kind of write performed by an Op.
+type OpKind int
+
+const (
+	OpInsert OpKind = iota
+	OpDelete
+)
+
+// Op is a single write in a batch passed to ApplyBatch. For OpDelete the item is
+// looked up by ID when ID is set, otherwise by the ID of Item.
+type Op[T any] struct {
+	Kind OpKind
+	Item T
+	ID   string
+}
+
+// InsertOp returns an Op that inserts or replaces item.
+func InsertOp[T any](item T) Op[T] {
+	return Op[T]{Kind: OpInsert, Item: item}
+}
+
+// DeleteOp returns an Op that deletes item.
+func DeleteOp[T any](item T) Op[T] {
+	return Op[T]{Kind: OpDelete, Item: item}
+}
+
+// DeleteIDOp returns an Op that deletes the item stored under id.
+func DeleteIDOp[T any](id string) Op[T] {
+	return Op[T]{Kind: OpDelete, ID: id}
+}
+
+// InsertMany inserts or replaces all items while holding the lock once. Like
+// ApplyBatch, it inserts none of them if one is rejected by a unique index.
+func (ds *DataStore[T]) InsertMany(items []T) error {
+	ops := make([]Op[T], len(items))
+	for i, item := range items {
+		ops[i] = InsertOp(item)
+	}
+	return ds.ApplyBatch(ops)
+}
+
+// DeleteMany deletes all items while holding the lock once. It returns the number of items removed.
+func (ds *DataStore[T]) DeleteMany(items []T) int {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	removed := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		id := ds.getID(item)
+		if _, ok := ds.items[id]; ok {
+			removed[id] = struct{}{}
+			ds.emitLocked(id, true)
+		}
+	}
+	ds.removeManyLocked(removed)
+	return len(removed)
+}
+
+// ApplyBatch applies ops in order while holding the lock once. Only the last op for
+// each ID matters, so the affected posting lists are rewritten a single time. With a
+// unique index the ops are applied one by one in a transaction, since each may replace
+// or be rejected by another item; if an insert fails with ErrDuplicate, none of the ops
+// are applied.
+func (ds *DataStore[T]) ApplyBatch(ops []Op[T]) error {
+	return ds.opts.reportError("batch", ds.applyBatch(ops))
+}
+
+func (ds *DataStore[T]) applyBatch(ops []Op[T]) error {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	if ds.hasUniqueLocked() {
+		return ds.applyUniqueLocked(ops)
+	}
+	ds.applyLocked(ops)
+	return nil
+}
+
+// applyUniqueLocked applies ops one at a time, rolling them all back on an error.
+func (ds *DataStore[T]) applyUniqueLocked(ops []Op[T]) error {
+	tx := ds.beginLocked()
+	for _, op := range ops {
+		if op.Kind == OpDelete {
+			tx.DeleteByID(ds.opID(op))
+		} else if err := tx.Insert(op.Item); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DataStore[T]) opID(op Op[T]) string {
+	if op.Kind == OpDelete && op.ID != "" {
+		return op.ID
+	}
+	return ds.getID(op.Item)
+}
+
+func (ds *DataStore[T]) applyLocked(ops []Op[T]) {
+	final := make(map[string]*T, len(ops))
+	var order []string
+	for i := range ops {
+		id := ds.opID(ops[i])
+		if _, seen := final[id]; !seen {
+			order = append(order, id)
+		}
+		if ops[i].Kind == OpDelete {
+			final[id] = nil
+		} else {
+			final[id] = &ops[i].Item
+		}
+	}
+
+	removed := make(map[string]struct{})
+	for _, id := range order {
+		_, ok := ds.items[id]
+		if ok {
+			removed[id] = struct{}{}
+		}
+		if final[id] != nil {
+			ds.emitLocked(id, false)
+		} else if ok {
+			ds.emitLocked(id, true)
+		}
+	}
+	ds.removeManyLocked(removed)
+
+	if len(ds.items) == 0 {
+		ds.items = make(map[string]T, len(order))
+		ds.itemKeys = make(map[string][]string, len(order))
+		ds.versions = make(map[string]uint64, len(order))
+	}
+	counts := make(map[string]int)
+	for _, id := range order {
+		item := final[id]
+		if item == nil {
+			continue
+		}
+		comps := ds.combinations(*item)
+		ds.items[id] = *item
+		ds.itemKeys[id] = comps
+		ds.touchLocked(id, comps)
+		ds.countFieldsLocked(comps, 1)
+		ds.clock++
+		ds.versions[id] = ds.clock
+		for _, key := range comps {
+			counts[key]++
+		}
+		ds.indexSchemaLocked(id, *item)
+	}
+	if len(ds.compositeIndex) == 0 {
+		ds.compositeIndex = make(map[string][]string, len(counts))
+	}
+	for key, n := range counts {
+		old := ds.compositeIndex[key]
+		ids := make([]string, len(old), len(old)+n)
+		copy(ids, old)
+		ds.compositeIndex[key] = ids
+	}
+	for _, id := range order {
+		if final[id] == nil {
+			continue
+		}
+		for _, key := range ds.itemKeys[id] {
+			ds.compositeIndex[key] = append(ds.compositeIndex[key], id)
+		}
+	}
+}
+
+// removeManyLocked removes every ID in removed, filtering each affected posting list once.
+func (ds *DataStore[T]) removeManyLocked(removed map[string]struct{}) {
+	if len(removed) == 0 {
+		return
+	}
+	affected := make(map[string]struct{})
+	for id := range removed {
+		ds.touchLocked(id, ds.itemKeys[id])
+		ds.countFieldsLocked(ds.itemKeys[id], -1)
+		for _, key := range ds.itemKeys[id] {
+			affected[key] = struct{}{}
+		}
+		ds.unindexSchemaLocked(id, ds.items[id])
+		delete(ds.items, id)
+		delete(ds.itemKeys, id)
+		delete(ds.versions, id)
+	}
+	for key := range affected {
+		newIDs := []string{}
+		for _, itemID := range ds.compositeIndex[key] {
+			if _, ok := removed[itemID]; !ok {
+				newIDs = append(newIDs, itemID)
+			}
+		}
+		ds.compositeIndex[key] = newIDs
+	}
+}
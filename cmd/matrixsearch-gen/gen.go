@@ -0,0 +1,671 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindScalar kind = iota
+	kindStruct
+	kindPointer
+	kindSlice
+	kindMap
+)
+
+// typeInfo describes a resolved field type.
+type typeInfo struct {
+	kind kind
+	// name is the Go source of the type as written in the package.
+	name string
+	// basic is the underlying scalar kind: string, bool, int, uint or float.
+	basic string
+	// named reports whether a scalar needs a conversion to its basic type.
+	named  bool
+	fields *ast.StructType
+	key    *typeInfo
+	elem   *typeInfo
+}
+
+var basicKinds = map[string]string{
+	"string": "string", "bool": "bool",
+	"int": "int", "int8": "int", "int16": "int", "int32": "int", "int64": "int", "rune": "int",
+	"uint": "uint", "uint8": "uint", "uint16": "uint", "uint32": "uint", "uint64": "uint", "byte": "uint", "uintptr": "uint",
+	"float32": "float", "float64": "float",
+}
+
+type generator struct {
+	pkg *pkgInfo
+	buf bytes.Buffer
+	// helpers maps struct type names to the name of their generated key function.
+	helpers map[string]string
+	pending []string
+	root    string
+	// seen names the set of keys already emitted by the slice being generated, if any.
+	seen string
+}
+
+// generate returns the formatted source for the requested types.
+func generate(pkg *pkgInfo, types []string, idField string) ([]byte, error) {
+	g := &generator{pkg: pkg}
+	for _, name := range types {
+		if err := g.generateType(name, idField); err != nil {
+			return nil, err
+		}
+	}
+	body := g.buf.String()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by matrixsearch-gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg.name)
+	for _, imp := range []string{"github.com/xvertile/matrixsearch", "slices", "sort", "strconv", "strings", "time"} {
+		name := imp[strings.LastIndex(imp, "/")+1:]
+		if regexp.MustCompile(`(^|[^\w.])` + name + `\.`).MatchString(body) {
+			fmt.Fprintf(&out, "\t%q\n", imp)
+		}
+	}
+	out.WriteString(")\n")
+	out.WriteString(body)
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+func (g *generator) generateType(name, idField string) error {
+	t, err := g.resolve(&ast.Ident{Name: name})
+	if err != nil {
+		return err
+	}
+	if t.kind != kindStruct {
+		return fmt.Errorf("%s is not a struct type", name)
+	}
+	g.root = name
+	g.helpers = make(map[string]string)
+	g.pending = nil
+
+	fmt.Fprintf(&g.buf, "\n// %sIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.\n", name)
+	fmt.Fprintf(&g.buf, "func %sIndexer(v %s) []string {\n\treturn %s(nil, \"\", nil, v)\n}\n", name, name, g.helper(name))
+	if idField != "" {
+		if err := g.generateID(t, idField); err != nil {
+			return err
+		}
+	}
+	if err := g.generateQuery(t); err != nil {
+		return err
+	}
+	for len(g.pending) > 0 {
+		next := g.pending[0]
+		g.pending = g.pending[1:]
+		if err := g.generateHelper(next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper returns the name of the key function for struct type name, scheduling it for
+// generation the first time it is requested.
+func (g *generator) helper(name string) string {
+	if fn, ok := g.helpers[name]; ok {
+		return fn
+	}
+	fn := "append" + g.root + "Keys"
+	if name != g.root {
+		fn = "append" + g.root + name + "Keys"
+	}
+	g.helpers[name] = fn
+	g.pending = append(g.pending, name)
+	return fn
+}
+
+func (g *generator) generateID(t *typeInfo, idField string) error {
+	for _, f := range structFields(t.fields) {
+		if f.name != idField {
+			continue
+		}
+		ft, err := g.resolve(f.typ)
+		if err != nil || ft.kind != kindScalar {
+			return fmt.Errorf("%s.%s: ID field must be a string, bool or number", g.root, idField)
+		}
+		fmt.Fprintf(&g.buf, "\n// %sID returns the ID of v.\nfunc %sID(v %s) string {\n\treturn %s\n}\n",
+			g.root, g.root, g.root, formatExpr(ft, "v."+idField))
+		return nil
+	}
+	return fmt.Errorf("%s has no field %s", g.root, idField)
+}
+
+func (g *generator) generateHelper(name string) error {
+	t, err := g.resolve(&ast.Ident{Name: name})
+	if err != nil {
+		return err
+	}
+	// path holds the structs reached through pointers, as in AutoIndexer, so a pointer
+	// back to one of them ends the recursion.
+	fmt.Fprintf(&g.buf, "\nfunc %s(keys []string, prefix string, path []any, v %s) []string {\n", g.helpers[name], name)
+	for _, f := range structFields(t.fields) {
+		if f.tag == "-" {
+			continue
+		}
+		ft, err := g.resolve(f.typ)
+		if err != nil {
+			if f.tag != "" {
+				return fmt.Errorf("%s.%s: %v", name, f.name, err)
+			}
+			continue
+		}
+		x := "v." + f.name
+		base, ptrs := deref(ft)
+		if base.kind == kindStruct {
+			prefix := "prefix"
+			if f.tag != "" {
+				prefix = "prefix+" + strconv.Quote(f.tag+".")
+			}
+			if ptrs == 0 {
+				fmt.Fprintf(&g.buf, "keys = %s(keys, %s, path, %s)\n", g.helper(base.name), prefix, x)
+				continue
+			}
+			for i := 1; i < ptrs; i++ {
+				fmt.Fprintf(&g.buf, "if %s != nil {\n", x)
+				x = "*" + x
+			}
+			fmt.Fprintf(&g.buf, "if %s != nil && !slices.Contains(path, any(%s)) {\n", x, x)
+			fmt.Fprintf(&g.buf, "keys = %s(keys, %s, append(path, %s), *%s)\n", g.helper(base.name), prefix, x, x)
+			g.buf.WriteString(strings.Repeat("}\n", ptrs))
+			continue
+		}
+		if f.tag == "" {
+			continue
+		}
+		d := parseDerived(f.opts)
+		if !d.noRaw {
+			if err := g.emitValue(x, ft, f.tag, f.opts, 0); err != nil {
+				return fmt.Errorf("%s.%s: %v", name, f.name, err)
+			}
+		}
+		g.emitDerived(x, ft, f.tag, d)
+	}
+	g.buf.WriteString("return keys\n}\n")
+	return nil
+}
+
+// emitDerived writes the statements for the bucket and extractor keys of a field.
+func (g *generator) emitDerived(x string, t *typeInfo, tag string, d derivedOptions) {
+	if base, ptrs := deref(t); d.bucketed() && numeric(base) {
+		n := x
+		for i := 0; i < ptrs; i++ {
+			fmt.Fprintf(&g.buf, "if %s != nil {\n", n)
+			n = "*" + n
+		}
+		key := strconv.Quote(tag + ".bucket:")
+		if d.bounds != "" {
+			fmt.Fprintf(&g.buf, "keys = append(keys, prefix+%s+matrixsearch.Bucket(%s, %s))\n", key, numberExpr(base, n), d.bounds)
+		}
+		if d.step != "" {
+			fmt.Fprintf(&g.buf, "keys = append(keys, prefix+%s+matrixsearch.StepBucket(%s, %s))\n", key, numberExpr(base, n), d.step)
+		}
+		g.buf.WriteString(strings.Repeat("}\n", ptrs))
+	}
+	for _, ex := range d.extractors {
+		fmt.Fprintf(&g.buf, "for _, s := range matrixsearch.Extract(%q, %s) {\nkeys = append(keys, prefix+%s+s)\n}\n",
+			ex, x, strconv.Quote(ex+":"))
+	}
+}
+
+// derivedOptions mirrors the bucket=, step=, noraw and extract= tag options of
+// matrixsearch.AutoIndexer. bounds and step hold Go source for the arguments.
+type derivedOptions struct {
+	bounds     string
+	step       string
+	noRaw      bool
+	extractors []string
+}
+
+func parseDerived(opts []string) derivedOptions {
+	var d derivedOptions
+	for _, opt := range opts {
+		name, arg, _ := strings.Cut(opt, "=")
+		switch name {
+		case "bucket":
+			var bounds []string
+			for _, s := range strings.Split(arg, ":") {
+				if _, err := strconv.ParseFloat(s, 64); err == nil {
+					bounds = append(bounds, s)
+				}
+			}
+			d.bounds = strings.Join(bounds, ", ")
+		case "step":
+			if f, err := strconv.ParseFloat(arg, 64); err == nil && f > 0 {
+				d.step = arg
+			}
+		case "noraw":
+			d.noRaw = true
+		case "extract":
+			d.extractors = append(d.extractors, arg)
+		}
+	}
+	return d
+}
+
+func (d derivedOptions) bucketed() bool {
+	return d.bounds != "" || d.step != ""
+}
+
+func numeric(t *typeInfo) bool {
+	switch t.basic {
+	case "int", "uint", "float", "duration":
+		return true
+	}
+	return false
+}
+
+// numberExpr returns x as a float64 expression, reading durations as seconds.
+func numberExpr(t *typeInfo, x string) string {
+	if t.basic == "duration" {
+		return paren(convert(t, "time.Duration", x)) + ".Seconds()"
+	}
+	return convert(t, "float64", x)
+}
+
+// emitValue writes the statements appending the keys for the tagged value x of type t.
+// opts are the tag options naming normalizers.
+func (g *generator) emitValue(x string, t *typeInfo, tag string, opts []string, depth int) error {
+	key := "prefix+" + strconv.Quote(tag+":")
+	switch t.kind {
+	case kindScalar:
+		if t.basic == "time" {
+			g.emitTime(x, t, tag, opts, depth)
+			break
+		}
+		s := normalizeExpr(opts, formatExpr(t, x))
+		if s != formatExpr(t, x) {
+			fmt.Fprintf(&g.buf, "if s := %s; s != \"\" {\n", s)
+			g.appendKey(key + "+s")
+			g.buf.WriteString("}\n")
+		} else if t.basic == "string" {
+			fmt.Fprintf(&g.buf, "if %s != \"\" {\n", s)
+			g.appendKey(key + "+" + s)
+			g.buf.WriteString("}\n")
+		} else {
+			g.appendKey(key + "+" + s)
+		}
+	case kindPointer:
+		fmt.Fprintf(&g.buf, "if %s != nil {\n", x)
+		if err := g.emitValue("*"+x, t.elem, tag, opts, depth); err != nil {
+			return err
+		}
+		g.buf.WriteString("}\n")
+	case kindSlice:
+		if base, _ := deref(t.elem); base.kind != kindScalar {
+			return fmt.Errorf("unsupported element type %s", t.elem.name)
+		}
+		e, seen := fmt.Sprintf("e%d", depth), fmt.Sprintf("seen%d", depth)
+		fmt.Fprintf(&g.buf, "if len(%s) > 0 {\n%s := make(map[string]bool, len(%s))\n", x, seen, x)
+		fmt.Fprintf(&g.buf, "for _, %s := range %s {\n", e, x)
+		outer := g.seen
+		g.seen = seen
+		err := g.emitValue(e, t.elem, tag, opts, depth+1)
+		g.seen = outer
+		if err != nil {
+			return err
+		}
+		g.buf.WriteString("}\n}\n")
+	case kindMap:
+		elem, ptrs := deref(t.elem)
+		if t.key.kind != kindScalar || elem.kind != kindScalar || ptrs > 1 {
+			return fmt.Errorf("unsupported map type %s", t.name)
+		}
+		k, e := fmt.Sprintf("k%d", depth), fmt.Sprintf("e%d", depth)
+		names, entries := fmt.Sprintf("names%d", depth), fmt.Sprintf("entries%d", depth)
+		fmt.Fprintf(&g.buf, "if len(%s) > 0 {\n", x)
+		fmt.Fprintf(&g.buf, "%s := make([]string, 0, len(%s))\n", names, x)
+		fmt.Fprintf(&g.buf, "%s := make(map[string]string, len(%s))\n", entries, x)
+		fmt.Fprintf(&g.buf, "for %s, %s := range %s {\n", k, e, x)
+		value := e
+		if ptrs == 1 {
+			fmt.Fprintf(&g.buf, "if %s == nil {\ncontinue\n}\n", e)
+			value = "*" + e
+		}
+		if elem.basic == "time" {
+			fmt.Fprintf(&g.buf, "if %s.IsZero() {\ncontinue\n}\n", paren(value))
+		}
+		fmt.Fprintf(&g.buf, "name, s := %s, %s\n", formatExpr(t.key, k), normalizeExpr(opts, formatExpr(elem, value)))
+		fmt.Fprintf(&g.buf, "if name != \"\" && s != \"\" {\n%s[name] = s\n%s = append(%s, name)\n}\n}\n", entries, names, names)
+		fmt.Fprintf(&g.buf, "sort.Strings(%s)\n", names)
+		fmt.Fprintf(&g.buf, "for _, name := range %s {\nkeys = append(keys, prefix+%s+matrixsearch.Escape(name)+\":\"+%s[name])\n}\n}\n",
+			names, strconv.Quote(tag+"."), entries)
+	default:
+		return fmt.Errorf("unsupported type %s", t.name)
+	}
+	return nil
+}
+
+// appendKey writes the statement appending the key expression key to keys. Inside a
+// slice, a key an earlier element already produced is skipped, as AutoIndexer does.
+func (g *generator) appendKey(key string) {
+	if g.seen == "" {
+		fmt.Fprintf(&g.buf, "keys = append(keys, %s)\n", key)
+		return
+	}
+	fmt.Fprintf(&g.buf, "if k := %s; !%s[k] {\n%s[k] = true\nkeys = append(keys, k)\n}\n", key, g.seen, g.seen)
+}
+
+// emitTime writes the statements for a time value: its Unix seconds key and, for a field
+// rather than a slice element, the bucket keys named by opts.
+func (g *generator) emitTime(x string, t *typeInfo, tag string, opts []string, depth int) {
+	fmt.Fprintf(&g.buf, "if !%s.IsZero() {\n", paren(x))
+	g.appendKey("prefix+" + strconv.Quote(tag+":") + "+" + formatExpr(t, x))
+	if depth == 0 {
+		first := true
+		for _, opt := range opts {
+			layout, ok := timeBuckets[opt]
+			if !ok {
+				continue
+			}
+			if first {
+				fmt.Fprintf(&g.buf, "utc := %s.UTC()\n", paren(convert(t, "time.Time", x)))
+				first = false
+			}
+			fmt.Fprintf(&g.buf, "keys = append(keys, prefix+%s+utc.Format(%q))\n", strconv.Quote(tag+"."+opt+":"), layout)
+		}
+	}
+	g.buf.WriteString("}\n")
+}
+
+// timeBuckets mirrors the time bucket tag options of matrixsearch.AutoIndexer.
+var timeBuckets = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+	"hour":  "2006-01-02T15",
+}
+
+// term is one indexed field in the generated query builder.
+type term struct {
+	method string
+	key    string
+	t      *typeInfo
+}
+
+func (g *generator) generateQuery(t *typeInfo) error {
+	var terms []term
+	if err := g.collectTerms(t, "", "", map[string]bool{g.root: true}, &terms); err != nil {
+		return err
+	}
+	seen := map[string]bool{"String": true}
+	for _, tm := range terms {
+		if seen[tm.method] {
+			return fmt.Errorf("%s: query method %s is generated twice; rename one of the fields", g.root, tm.method)
+		}
+		seen[tm.method] = true
+	}
+	b := g.root + "QueryBuilder"
+	fmt.Fprintf(&g.buf, "\n// %s builds queries against the keys produced by %sIndexer. Terms are emitted in\n", b, g.root)
+	fmt.Fprintf(&g.buf, "// indexer order, whatever order the methods are called in.\ntype %s struct {\n\tterms [%d][]string\n}\n", b, len(terms))
+	fmt.Fprintf(&g.buf, "\n// %sQuery returns an empty query builder for %s.\nfunc %sQuery() *%s {\n\treturn &%s{}\n}\n", g.root, g.root, g.root, b, b)
+	for i, tm := range terms {
+		switch tm.t.kind {
+		case kindMap:
+			elem, _ := deref(tm.t.elem)
+			fmt.Fprintf(&g.buf, "\nfunc (q *%s) %s(key %s, v %s) *%s {\n", b, tm.method, tm.t.key.name, elem.name, b)
+			fmt.Fprintf(&g.buf, "q.terms[%d] = append(q.terms[%d], %s+%s+\":\"+%s)\nreturn q\n}\n",
+				i, i, strconv.Quote(escape(tm.key)+"."), queryExpr(tm.t.key, "key"), queryExpr(elem, "v"))
+		default:
+			elem := tm.t
+			if elem.kind == kindSlice {
+				elem = elem.elem
+			}
+			elem, _ = deref(elem)
+			fmt.Fprintf(&g.buf, "\nfunc (q *%s) %s(v %s) *%s {\n", b, tm.method, elem.name, b)
+			fmt.Fprintf(&g.buf, "q.terms[%d] = append(q.terms[%d], %s+%s)\nreturn q\n}\n",
+				i, i, strconv.Quote(escape(tm.key)+":"), queryExpr(elem, "v"))
+		}
+	}
+	fmt.Fprintf(&g.buf, "\n// String returns the query in the form accepted by DataStore.Search.\nfunc (q *%s) String() string {\n", b)
+	g.buf.WriteString("var parts []string\nfor _, t := range q.terms {\nparts = append(parts, t...)\n}\nreturn strings.Join(parts, \":\")\n}\n")
+	return nil
+}
+
+// collectTerms lists the indexed fields of t in indexer order. Struct types already on
+// the current path are skipped so self-referencing types stay finite.
+func (g *generator) collectTerms(t *typeInfo, keyPrefix, methodPrefix string, path map[string]bool, terms *[]term) error {
+	for _, f := range structFields(t.fields) {
+		if f.tag == "-" {
+			continue
+		}
+		ft, err := g.resolve(f.typ)
+		if err != nil {
+			continue
+		}
+		base, _ := deref(ft)
+		if base.kind == kindStruct {
+			if path[base.name] {
+				continue
+			}
+			subKey, subMethod := keyPrefix, methodPrefix
+			if f.tag != "" {
+				subKey, subMethod = keyPrefix+f.tag+".", methodPrefix+f.name
+			}
+			path[base.name] = true
+			err := g.collectTerms(base, subKey, subMethod, path, terms)
+			delete(path, base.name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if f.tag == "" {
+			continue
+		}
+		d := parseDerived(f.opts)
+		if !d.noRaw {
+			*terms = append(*terms, term{method: methodPrefix + f.name, key: keyPrefix + f.tag, t: base})
+		}
+		if d.bucketed() && numeric(base) {
+			*terms = append(*terms, term{method: methodPrefix + f.name + "Bucket", key: keyPrefix + f.tag + ".bucket", t: stringType})
+		}
+		for _, ex := range d.extractors {
+			*terms = append(*terms, term{method: methodPrefix + exportName(ex), key: keyPrefix + ex, t: stringType})
+		}
+	}
+	return nil
+}
+
+type structField struct {
+	name string
+	tag  string
+	opts []string
+	typ  ast.Expr
+}
+
+// structFields flattens st into one entry per field name. Embedded fields are named
+// after their type.
+func structFields(st *ast.StructType) []structField {
+	var fields []structField
+	for _, f := range st.Fields.List {
+		var tag string
+		var opts []string
+		if f.Tag != nil {
+			raw, _ := strconv.Unquote(f.Tag.Value)
+			tag, opts = parseTag(reflect.StructTag(raw).Get("text"))
+		}
+		if len(f.Names) == 0 {
+			typ := f.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if ident, ok := typ.(*ast.Ident); ok {
+				fields = append(fields, structField{name: ident.Name, tag: tag, opts: opts, typ: f.Type})
+			}
+			continue
+		}
+		for _, n := range f.Names {
+			fields = append(fields, structField{name: n.Name, tag: tag, opts: opts, typ: f.Type})
+		}
+	}
+	return fields
+}
+
+func (g *generator) resolve(expr ast.Expr) (*typeInfo, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if basic, ok := basicKinds[e.Name]; ok {
+			return &typeInfo{kind: kindScalar, name: e.Name, basic: basic}, nil
+		}
+		decl, ok := g.pkg.types[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s", e.Name)
+		}
+		if st, ok := decl.(*ast.StructType); ok {
+			return &typeInfo{kind: kindStruct, name: e.Name, fields: st}, nil
+		}
+		u, err := g.resolve(decl)
+		if err != nil {
+			return nil, err
+		}
+		t := *u
+		t.name = e.Name
+		t.named = t.kind == kindScalar
+		return &t, nil
+	case *ast.StarExpr:
+		elem, err := g.resolve(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindPointer, name: "*" + elem.name, elem: elem}, nil
+	case *ast.ArrayType:
+		elem, err := g.resolve(e.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindSlice, name: "[]" + elem.name, elem: elem}, nil
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch e.Sel.Name {
+			case "Time":
+				return &typeInfo{kind: kindScalar, name: "time.Time", basic: "time"}, nil
+			case "Duration":
+				return &typeInfo{kind: kindScalar, name: "time.Duration", basic: "duration"}, nil
+			}
+		}
+	case *ast.MapType:
+		key, err := g.resolve(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := g.resolve(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &typeInfo{kind: kindMap, name: "map[" + key.name + "]" + elem.name, key: key, elem: elem}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", expr)
+}
+
+var stringType = &typeInfo{kind: kindScalar, name: "string", basic: "string"}
+
+// exportName capitalizes the first letter of s, turning an extractor name into a
+// method name.
+func exportName(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// deref strips pointer types from t and reports how many were removed.
+func deref(t *typeInfo) (*typeInfo, int) {
+	n := 0
+	for t.kind == kindPointer {
+		t = t.elem
+		n++
+	}
+	return t, n
+}
+
+// formatExpr returns the expression rendering the scalar x of type t as a key value.
+func formatExpr(t *typeInfo, x string) string {
+	switch t.basic {
+	case "string":
+		return convert(t, "string", x)
+	case "bool":
+		return "strconv.FormatBool(" + convert(t, "bool", x) + ")"
+	case "int":
+		return "strconv.FormatInt(" + convert(t, "int64", x) + ", 10)"
+	case "uint":
+		return "strconv.FormatUint(" + convert(t, "uint64", x) + ", 10)"
+	case "float":
+		return "strconv.FormatFloat(" + convert(t, "float64", x) + ", 'f', -1, 64)"
+	case "time":
+		return "strconv.FormatInt(" + paren(convert(t, "time.Time", x)) + ".Unix(), 10)"
+	case "duration":
+		return "strconv.FormatFloat(" + paren(convert(t, "time.Duration", x)) + ".Seconds(), 'f', -1, 64)"
+	}
+	return x
+}
+
+// paren parenthesizes a dereference so a method can be called on its result.
+func paren(x string) string {
+	if strings.HasPrefix(x, "*") {
+		return "(" + x + ")"
+	}
+	return x
+}
+
+// convert converts x to target unless t already is that type.
+func convert(t *typeInfo, target, x string) string {
+	if t.name == target {
+		return x
+	}
+	return target + "(" + x + ")"
+}
+
+// normalizers maps the normalizer tag options to the matrixsearch functions applying them.
+var normalizers = map[string]string{
+	"lower": "Lower",
+	"upper": "Upper",
+	"trim":  "Trim",
+	"fold":  "Fold",
+	"nfc":   "NFC",
+	"nfkc":  "NFKC",
+}
+
+// parseTag splits a text tag into its key name and options.
+func parseTag(tag string) (string, []string) {
+	name, rest, ok := strings.Cut(tag, ",")
+	if !ok {
+		return name, nil
+	}
+	return name, strings.Split(rest, ",")
+}
+
+// normalizeExpr wraps the string expression x in the normalizers named by opts.
+func normalizeExpr(opts []string, x string) string {
+	for _, opt := range opts {
+		if fn, ok := normalizers[opt]; ok {
+			x = "matrixsearch." + fn + "(" + x + ")"
+		}
+	}
+	return x
+}
+
+// queryExpr is like formatExpr but escapes string values for use in a search query.
+// Numbers and booleans never contain the separator.
+func queryExpr(t *typeInfo, x string) string {
+	if t.basic == "string" {
+		return "matrixsearch.Escape(" + formatExpr(t, x) + ")"
+	}
+	return formatExpr(t, x)
+}
+
+// escape mirrors matrixsearch.Escape for field names known at generation time.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ":", `\:`).Replace(s)
+}
@@ -0,0 +1,59 @@
+// Command matrixsearch-gen generates reflection-free indexers for structs annotated
+// with text tags. For each type it writes:
+//
+//   - <Type>Indexer, a func(<Type>) []string producing the same keys as
+//     matrixsearch.AutoIndexer
+//   - <Type>ID, a func(<Type>) string returning the field named by -id
+//   - <Type>Query, a typed query builder with one method per indexed field, e.g.
+//     ProxyQuery().Country("us").SpeedType("fast").String()
+//
+// Because queries are built through generated methods, renaming or removing a tag and
+// regenerating breaks the build wherever the old field is still queried.
+//
+// Usage:
+//
+//	//go:generate go run github.com/xvertile/matrixsearch/cmd/matrixsearch-gen -type=Proxy -id=ID
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; required")
+	idField := flag.String("id", "", "name of the field returned by the generated <Type>ID function")
+	output := flag.String("output", "", "output file name; default <type>_matrixsearch.go")
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+	if err := run(dir, types, *idField, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "matrixsearch-gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, types []string, idField, output string) error {
+	pkg, err := loadPackage(dir, types[0])
+	if err != nil {
+		return err
+	}
+	src, err := generate(pkg, types, idField)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = strings.ToLower(types[0]) + "_matrixsearch.go"
+	}
+	return os.WriteFile(filepath.Join(dir, output), src, 0o644)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pkgInfo holds the type declarations of the package that declares the requested types.
+type pkgInfo struct {
+	name  string
+	types map[string]ast.Expr
+}
+
+// loadPackage parses the Go files in dir, including test files, and collects the type
+// declarations of the package that declares typeName.
+func loadPackage(dir, typeName string) (*pkgInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	byPkg := make(map[string]*pkgInfo)
+	var found *pkgInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok := byPkg[f.Name.Name]
+		if !ok {
+			pkg = &pkgInfo{name: f.Name.Name, types: make(map[string]ast.Expr)}
+			byPkg[f.Name.Name] = pkg
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.TypeParams != nil {
+					continue
+				}
+				pkg.types[ts.Name.Name] = ts.Type
+				if ts.Name.Name == typeName {
+					found = pkg
+				}
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("type %s not found in %s", typeName, dir)
+	}
+	return found, nil
+}
@@ -0,0 +1,161 @@
+package matrixsearch
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Extractor computes derived values from a field value. AutoIndexer calls the
+// extractors named in a field's tag and indexes each returned value under the
+// extractor's name, e.g. speedtype:fast for `text:"speed,extract=speedtype"`.
+type Extractor func(value any) []string
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = make(map[string]Extractor)
+)
+
+// RegisterExtractor makes fn available to the extract= tag option under name.
+// Registering the same name again replaces the previous extractor.
+func RegisterExtractor(name string, fn Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors[name] = fn
+}
+
+// Extract runs the extractor registered under name on value. It returns nil if no
+// extractor is registered under name.
+func Extract(name string, value any) []string {
+	extractorsMu.RLock()
+	fn := extractors[name]
+	extractorsMu.RUnlock()
+	if fn == nil {
+		return nil
+	}
+	return fn(value)
+}
+
+// Bucket returns the label of the interval of bounds that contains v, e.g. "75-150" for
+// v = 100 and bounds 0, 75, 150. Values below the first bound are labelled "<0" and
+// values from the last bound on "150+". bounds must be ascending.
+func Bucket(v float64, bounds ...float64) string {
+	if len(bounds) == 0 {
+		return ""
+	}
+	if v < bounds[0] {
+		return "<" + formatNumber(bounds[0])
+	}
+	for i := 1; i < len(bounds); i++ {
+		if v < bounds[i] {
+			return formatNumber(bounds[i-1]) + "-" + formatNumber(bounds[i])
+		}
+	}
+	return formatNumber(bounds[len(bounds)-1]) + "+"
+}
+
+// StepBucket returns the label of the interval of width step that contains v, e.g.
+// "5-10" for v = 7.5 and step 5.
+func StepBucket(v, step float64) string {
+	if step <= 0 {
+		return ""
+	}
+	lo := math.Floor(v/step) * step
+	return formatNumber(lo) + "-" + formatNumber(lo+step)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// derivedOptions are the tag options that add keys computed from a field value.
+type derivedOptions struct {
+	bounds     []float64
+	step       float64
+	noRaw      bool
+	extractors []string
+}
+
+// parseDerived reads the bucket=, step=, extract= and noraw options of a text tag.
+// Options it does not know, such as normalizers, are ignored.
+func parseDerived(opts []string) derivedOptions {
+	var d derivedOptions
+	for _, opt := range opts {
+		name, arg, _ := strings.Cut(opt, "=")
+		switch name {
+		case "bucket":
+			d.bounds = d.bounds[:0]
+			for _, s := range strings.Split(arg, ":") {
+				if f, err := strconv.ParseFloat(s, 64); err == nil {
+					d.bounds = append(d.bounds, f)
+				}
+			}
+		case "step":
+			d.step, _ = strconv.ParseFloat(arg, 64)
+		case "noraw":
+			d.noRaw = true
+		case "extract":
+			d.extractors = append(d.extractors, arg)
+		}
+	}
+	return d
+}
+
+func (d derivedOptions) bucketed() bool {
+	return len(d.bounds) > 0 || d.step > 0
+}
+
+// derivedEmitter returns the emitter for the bucket and extractor keys of a field of
+// type t named name, or nil if d asks for none that apply to t. Extractor keys are named
+// after the extractor, under the prefix of the enclosing struct.
+func derivedEmitter(t reflect.Type, name string, d derivedOptions) emitter {
+	base, _ := derefType(t)
+	number := numberFor(base)
+	bucketed := d.bucketed() && number != nil
+	if !bucketed && len(d.extractors) == 0 {
+		return nil
+	}
+	bucketKey := name + ".bucket:"
+	return func(keys []string, w walker, v reflect.Value) []string {
+		if bucketed {
+			if n := indirect(v); n.IsValid() {
+				f := number(n)
+				if len(d.bounds) > 0 {
+					keys = append(keys, w.prefix+bucketKey+Bucket(f, d.bounds...))
+				}
+				if d.step > 0 {
+					keys = append(keys, w.prefix+bucketKey+StepBucket(f, d.step))
+				}
+			}
+		}
+		if len(d.extractors) > 0 && v.CanInterface() {
+			value := v.Interface()
+			for _, ex := range d.extractors {
+				for _, s := range Extract(ex, value) {
+					keys = append(keys, w.prefix+ex+":"+s)
+				}
+			}
+		}
+		return keys
+	}
+}
+
+// numberFor returns the function reading values of type t as a number, or nil if t is
+// not numeric. Durations are read as seconds.
+func numberFor(t reflect.Type) func(reflect.Value) float64 {
+	if t == durationType {
+		return func(v reflect.Value) float64 { return time.Duration(v.Int()).Seconds() }
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) float64 { return float64(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) float64 { return float64(v.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		return reflect.Value.Float
+	}
+	return nil
+}
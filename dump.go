@@ -0,0 +1,408 @@
+package matrixsearch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrDumpTooLarge is returned when a store has more nodes than can be drawn meaningfully
+// in a graphical dump format.
+var ErrDumpTooLarge = errors.New("matrixsearch: store too large to dump")
+
+// DumpFormat selects the output of DumpTo.
+type DumpFormat string
+
+const (
+	// DumpFormatSVG draws the graph as an SVG image without external tools.
+	DumpFormatSVG DumpFormat = "svg"
+	// DumpFormatDOT writes the graph in Graphviz DOT format.
+	DumpFormatDOT DumpFormat = "dot"
+	// DumpFormatJSON lists the keys by level with their cardinalities and sample item IDs.
+	DumpFormatJSON DumpFormat = "json"
+	// DumpFormatMermaid writes a Mermaid flowchart for Markdown documents.
+	DumpFormatMermaid DumpFormat = "mermaid"
+	// DumpFormatHTML writes a self-contained page with expandable key nodes.
+	DumpFormatHTML DumpFormat = "html"
+	// DumpFormatText draws the graph as an ASCII tree for terminals.
+	DumpFormatText DumpFormat = "text"
+)
+
+const (
+	// defaultDumpDirectItems is the default for WithDumpDirectItems.
+	defaultDumpDirectItems = 5
+	// maxDumpNodes limits the number of nodes in the graphical dump formats.
+	maxDumpNodes = 2000
+)
+
+// WithDumpDirectItems sets the largest posting list that dumps show item by item. Keys
+// with more items are collapsed into a single "n items" node. The default is 5.
+func WithDumpDirectItems(n int) Option {
+	return func(o *options) {
+		o.dumpDirectItems = n
+	}
+}
+
+type dumpKind int
+
+const (
+	dumpStats dumpKind = iota
+	dumpCategory
+	dumpLevel
+	dumpKey
+	dumpItem
+	dumpItems
+)
+
+// dumpNode is a node of the graph drawn by Dump: the key category, one level per
+// number of field:value pairs, the keys of each level and the items under each key.
+type dumpNode struct {
+	id       string
+	kind     dumpKind
+	lines    []string
+	children []*dumpNode
+	// count holds the posting list length of a key node and the number of field:value
+	// pairs of a level node. sample holds the first item IDs of a key node.
+	count  int
+	sample []string
+
+	x, y, w, h float64
+}
+
+// dumpGraph is the graph drawn by Dump, collected under the read lock so that it can be
+// written out without holding it. keys and items count what the dump covers; matched is
+// the number of keys selected before DumpOptions.MaxKeys was applied.
+type dumpGraph struct {
+	keys, items int
+	matched     int
+	root        *dumpNode
+	nodes       int
+}
+
+// keyCount renders the number of keys in the dump, noting how many were cut off by
+// DumpOptions.MaxKeys.
+func (g *dumpGraph) keyCount() string {
+	if g.matched > g.keys {
+		return fmt.Sprintf("%d of %d", g.keys, g.matched)
+	}
+	return strconv.Itoa(g.keys)
+}
+
+// DumpOptions restricts a dump to part of a store, for stores too large to dump whole.
+// The zero value dumps everything.
+type DumpOptions struct {
+	// Query limits the dump to the keys of the items matching Query that contain all of
+	// its field:value pairs, e.g. every key under country:us.
+	Query string
+	// MaxKeys limits the number of keys. Keys with fewer components come first.
+	MaxKeys int
+	// MaxDepth limits keys to at most MaxDepth field:value pairs.
+	MaxDepth int
+	// Fields limits keys to those made up only of the listed fields.
+	Fields []string
+	// SampleItems sets the number of item IDs shown per key, overriding
+	// WithDumpDirectItems.
+	SampleItems int
+}
+
+// dumpGraphLocked collects the graph of the keys selected by opts. It returns
+// ErrDumpTooLarge if limit is positive and the graph has more nodes.
+func (ds *DataStore[T]) dumpGraphLocked(opts DumpOptions, limit int) (*dumpGraph, error) {
+	direct := ds.opts.dumpDirectItems
+	if opts.SampleItems > 0 {
+		direct = opts.SampleItems
+	} else if direct <= 0 {
+		direct = defaultDumpDirectItems
+	}
+	keys, items := ds.dumpKeysLocked(opts)
+	g := &dumpGraph{items: items, matched: len(keys)}
+	if opts.MaxKeys > 0 && len(keys) > opts.MaxKeys {
+		keys = keys[:opts.MaxKeys]
+	}
+	g.keys = len(keys)
+	g.root = &dumpNode{id: "keyCategory", kind: dumpCategory, lines: []string{"Composite Keys"}}
+	g.nodes = 2
+
+	var levelNode *dumpNode
+	for _, key := range keys {
+		if level := keyPairs(key); levelNode == nil || levelNode.count != level {
+			label := fmt.Sprintf("%d-Component Keys", level)
+			if level == 1 {
+				label = "Simple Keys"
+			}
+			levelNode = &dumpNode{id: fmt.Sprintf("keyLevel_%d", level), kind: dumpLevel, lines: []string{label}, count: level}
+			g.root.children = append(g.root.children, levelNode)
+			g.nodes++
+		}
+		ids := ds.compositeIndex[key]
+		keyNode := &dumpNode{id: key, kind: dumpKey, lines: []string{key, fmt.Sprintf("(%d items)", len(ids))}, count: len(ids)}
+		if keyNode.sample = ids; len(ids) > direct {
+			keyNode.sample = ids[:direct]
+		}
+		levelNode.children = append(levelNode.children, keyNode)
+		if len(ids) <= direct {
+			for _, id := range ids {
+				keyNode.children = append(keyNode.children, &dumpNode{id: key + "_item_" + id, kind: dumpItem, lines: []string{id}})
+			}
+		} else {
+			keyNode.children = append(keyNode.children, &dumpNode{id: key + "_items", kind: dumpItems, lines: []string{fmt.Sprintf("%d items", len(ids))}})
+		}
+		if g.nodes += 1 + len(keyNode.children); limit > 0 && g.nodes > limit {
+			return nil, fmt.Errorf("%w: more than %d nodes; narrow it with DumpOptions", ErrDumpTooLarge, limit)
+		}
+	}
+	return g, nil
+}
+
+// dumpKeysLocked returns the keys selected by opts, ordered by number of components and
+// then by key, and the number of items they cover. With a query only the keys of the
+// matching items are visited, not the whole index.
+func (ds *DataStore[T]) dumpKeysLocked(opts DumpOptions) ([]string, int) {
+	var fields map[string]bool
+	if len(opts.Fields) > 0 {
+		fields = make(map[string]bool, len(opts.Fields))
+		for _, f := range opts.Fields {
+			fields[f] = true
+		}
+	}
+	selected := func(key string) bool {
+		if opts.MaxDepth > 0 && keyPairs(key) > opts.MaxDepth {
+			return false
+		}
+		if fields != nil {
+			parts := keyParts(key)
+			for i := 0; i < len(parts); i += 2 {
+				if !fields[unescape(parts[i])] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	var keys []string
+	items := len(ds.items)
+	if opts.Query != "" {
+		query := ds.opts.searchKey(opts.Query)
+		ids := ds.lookupLocked(query)
+		items = len(ids)
+		pairs := keyPairStrings(query)
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			for _, key := range ds.itemKeys[id] {
+				if !seen[key] {
+					seen[key] = true
+					if selected(key) && containsPairs(key, pairs) {
+						keys = append(keys, key)
+					}
+				}
+			}
+		}
+	} else {
+		for key := range ds.compositeIndex {
+			if selected(key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if li, lj := keyPairs(keys[i]), keyPairs(keys[j]); li != lj {
+			return li < lj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys, items
+}
+
+// keyParts splits a stored key at its unescaped ':' separators, leaving escapes in place.
+func keyParts(key string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\':
+			i++
+		case ':':
+			parts = append(parts, key[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, key[start:])
+}
+
+// keyPairStrings returns the field:value pairs of a stored key.
+func keyPairStrings(key string) []string {
+	parts := keyParts(key)
+	pairs := make([]string, 0, (len(parts)+1)/2)
+	for i := 0; i+1 < len(parts); i += 2 {
+		pairs = append(pairs, parts[i]+":"+parts[i+1])
+	}
+	return pairs
+}
+
+// containsPairs reports whether key holds every pair in pairs.
+func containsPairs(key string, pairs []string) bool {
+	have := keyPairStrings(key)
+	for _, p := range pairs {
+		found := false
+		for _, h := range have {
+			if h == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// keyPairs returns the number of field:value pairs in a stored key.
+func keyPairs(key string) int {
+	n := 1
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\':
+			i++
+		case ':':
+			n++
+		}
+	}
+	return (n + 1) / 2
+}
+
+// dumpExtensions maps file extensions to the format Dump writes for them.
+var dumpExtensions = map[string]DumpFormat{
+	".dot":     DumpFormatDOT,
+	".gv":      DumpFormatDOT,
+	".json":    DumpFormatJSON,
+	".mmd":     DumpFormatMermaid,
+	".mermaid": DumpFormatMermaid,
+	".html":    DumpFormatHTML,
+	".htm":     DumpFormatHTML,
+	".txt":     DumpFormatText,
+}
+
+// Dump writes the store's keys and items to filename, in the format given by its
+// extension: .dot, .json, .mmd, .html or .txt, and an SVG image otherwise.
+func (ds *DataStore[T]) Dump(filename string) error {
+	format, ok := dumpExtensions[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		format = DumpFormatSVG
+	}
+	var b bytes.Buffer
+	if err := ds.DumpTo(&b, format); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b.Bytes(), 0o644)
+}
+
+// DumpTo writes the store's keys and items to w in format. The graphical formats SVG,
+// DOT and Mermaid return ErrDumpTooLarge when the store has too many keys to draw.
+func (ds *DataStore[T]) DumpTo(w io.Writer, format DumpFormat) error {
+	return ds.DumpWith(w, format, DumpOptions{})
+}
+
+// DumpWith is DumpTo restricted to the part of the store selected by opts.
+func (ds *DataStore[T]) DumpWith(w io.Writer, format DumpFormat, opts DumpOptions) error {
+	var write func(*dumpGraph, io.Writer) error
+	limit := 0
+	switch format {
+	case DumpFormatSVG:
+		write, limit = (*dumpGraph).writeSVG, maxDumpNodes
+	case DumpFormatDOT:
+		write, limit = (*dumpGraph).writeDOT, maxDumpNodes
+	case DumpFormatMermaid:
+		write, limit = (*dumpGraph).writeMermaid, maxDumpNodes
+	case DumpFormatJSON:
+		write = (*dumpGraph).writeJSON
+	case DumpFormatHTML:
+		write = (*dumpGraph).writeHTML
+	case DumpFormatText:
+		write = (*dumpGraph).writeText
+	default:
+		return ds.opts.reportError("dump", fmt.Errorf("matrixsearch: unknown dump format %q", format))
+	}
+	ds.mu.RLock()
+	g, err := ds.dumpGraphLocked(opts, limit)
+	ds.mu.RUnlock()
+	if err == nil {
+		err = write(g, w)
+	}
+	return ds.opts.reportError("dump", err)
+}
+
+// DumpSVG writes the image drawn by Dump to w.
+func (ds *DataStore[T]) DumpSVG(w io.Writer) error {
+	return ds.DumpTo(w, DumpFormatSVG)
+}
+
+// DumpDOT writes the graph drawn by Dump to w in Graphviz DOT format, for rendering with
+// dot or another Graphviz tool.
+func (ds *DataStore[T]) DumpDOT(w io.Writer) error {
+	return ds.DumpTo(w, DumpFormatDOT)
+}
+
+// escapeDOT escapes backslashes and double quotes in strings for DOT.
+func escapeDOT(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\"", "\\\"").Replace(s)
+}
+
+func (g *dumpGraph) writeDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("digraph DataStore {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  splines=polyline;\n")
+	b.WriteString("  ranksep=0.8;\n")
+	b.WriteString("  nodesep=0.5;\n")
+	b.WriteString("  fontname=\"Arial\";\n")
+	b.WriteString("  node [fontname=\"Arial\", fontsize=11];\n")
+	b.WriteString("  edge [fontname=\"Arial\", fontsize=9, arrowsize=0.7];\n")
+
+	fmt.Fprintf(b, "  \"stats\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#E6E6FA\"><B>DataStore Statistics</B></TD></TR><TR><TD ALIGN=\"left\">Total Keys: %s</TD></TR><TR><TD ALIGN=\"left\">Total Items: %d</TD></TR></TABLE>>, fontsize=12];\n",
+		g.keyCount(), g.items)
+	b.WriteString("  \"keyCategory\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#D0E0FF\"><B>Composite Keys</B></TD></TR></TABLE>>, fontsize=12];\n")
+	b.WriteString("  \"stats\" -> \"keyCategory\" [style=invis];\n")
+
+	for _, level := range g.root.children {
+		fmt.Fprintf(b, "  \"%s\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#E0EFFF\">%s</TD></TR></TABLE>>, fontsize=11];\n",
+			level.id, level.lines[0])
+		fmt.Fprintf(b, "  \"keyCategory\" -> \"%s\";\n", level.id)
+		for _, key := range level.children {
+			id := escapeDOT(key.id)
+			fmt.Fprintf(b, "  \"%s\" [shape=box, style=\"rounded,filled\", fillcolor=\"#F0F8FF\", label=\"%s\\n%s\"];\n",
+				id, id, key.lines[1])
+			fmt.Fprintf(b, "  \"%s\" -> \"%s\";\n", level.id, id)
+			for _, item := range key.children {
+				itemID := escapeDOT(item.id)
+				if item.kind == dumpItem {
+					fmt.Fprintf(b, "  \"%s\" [shape=ellipse, style=\"filled\", fillcolor=\"#FFE6E6\", label=\"%s\"];\n",
+						itemID, escapeDOT(item.lines[0]))
+				} else {
+					fmt.Fprintf(b, "  \"%s\" [shape=folder, style=\"filled\", fillcolor=\"#FFEFEF\", label=\"%s\"];\n",
+						itemID, item.lines[0])
+				}
+				fmt.Fprintf(b, "  \"%s\" -> \"%s\";\n", id, itemID)
+			}
+		}
+	}
+
+	if len(g.root.children) > 1 {
+		b.WriteString("  { rank=same; ")
+		for _, level := range g.root.children {
+			fmt.Fprintf(b, "\"%s\"; ", level.id)
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("  { rank=source; \"stats\"; \"keyCategory\"; }\n")
+	b.WriteString("}\n")
+	return b.Flush()
+}
@@ -0,0 +1,172 @@
+package matrixsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+type dumpJSON struct {
+	Keys        int             `json:"keys"`
+	MatchedKeys int             `json:"matched_keys"`
+	Items       int             `json:"items"`
+	Levels      []dumpJSONLevel `json:"levels"`
+}
+
+type dumpJSONLevel struct {
+	Components int           `json:"components"`
+	Keys       []dumpJSONKey `json:"keys"`
+}
+
+type dumpJSONKey struct {
+	Key       string   `json:"key"`
+	Count     int      `json:"count"`
+	SampleIDs []string `json:"sample_ids"`
+}
+
+func (g *dumpGraph) writeJSON(w io.Writer) error {
+	out := dumpJSON{Keys: g.keys, MatchedKeys: g.matched, Items: g.items, Levels: []dumpJSONLevel{}}
+	for _, level := range g.root.children {
+		l := dumpJSONLevel{Components: level.count, Keys: make([]dumpJSONKey, len(level.children))}
+		for i, key := range level.children {
+			l.Keys[i] = dumpJSONKey{Key: key.id, Count: key.count, SampleIDs: key.sample}
+		}
+		out.Levels = append(out.Levels, l)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// escapeMermaid replaces the characters that end or break a quoted Mermaid label with
+// entity codes.
+func escapeMermaid(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+func (g *dumpGraph) writeMermaid(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString("graph TD\n")
+	fmt.Fprintf(b, "  stats[\"<b>DataStore Statistics</b><br/>Total Keys: %s<br/>Total Items: %d\"]:::stats\n", g.keyCount(), g.items)
+	b.WriteString("  keyCategory[\"<b>Composite Keys</b>\"]:::category\n")
+	b.WriteString("  stats ~~~ keyCategory\n")
+	next := 0
+	var walk func(parent string, n *dumpNode)
+	walk = func(parent string, n *dumpNode) {
+		id := fmt.Sprintf("n%d", next)
+		next++
+		label := make([]string, len(n.lines))
+		for i, line := range n.lines {
+			label[i] = escapeMermaid(line)
+		}
+		text := strings.Join(label, "<br/>")
+		switch n.kind {
+		case dumpLevel:
+			fmt.Fprintf(b, "  %s[\"%s\"]:::level\n", id, text)
+		case dumpKey:
+			fmt.Fprintf(b, "  %s(\"%s\"):::key\n", id, text)
+		case dumpItem:
+			fmt.Fprintf(b, "  %s([\"%s\"]):::item\n", id, text)
+		case dumpItems:
+			fmt.Fprintf(b, "  %s[/\"%s\"/]:::items\n", id, text)
+		}
+		fmt.Fprintf(b, "  %s --> %s\n", parent, id)
+		for _, c := range n.children {
+			walk(id, c)
+		}
+	}
+	for _, level := range g.root.children {
+		walk("keyCategory", level)
+	}
+	for kind, class := range []string{"stats", "category", "level", "key", "item", "items"} {
+		fmt.Fprintf(b, "  classDef %s fill:%s,stroke:#333\n", class, svgFills[dumpKind(kind)])
+	}
+	return b.Flush()
+}
+
+// writeText draws the graph as an ASCII tree.
+func (g *dumpGraph) writeText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "DataStore: %s keys, %d items\n", g.keyCount(), g.items)
+	b.WriteString(g.root.lines[0] + "\n")
+	var walk func(n *dumpNode, indent string, last bool)
+	walk = func(n *dumpNode, indent string, last bool) {
+		branch, child := "|-- ", "|   "
+		if last {
+			branch, child = "`-- ", "    "
+		}
+		b.WriteString(indent + branch + strings.Join(n.lines, " ") + "\n")
+		for i, c := range n.children {
+			walk(c, indent+child, i == len(n.children)-1)
+		}
+	}
+	for i, level := range g.root.children {
+		walk(level, "", i == len(g.root.children)-1)
+	}
+	return b.Flush()
+}
+
+const dumpHTMLHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>DataStore</title>
+<style>
+body { font-family: Arial, sans-serif; font-size: 13px; margin: 20px; }
+.stats { background: #E6E6FA; border: 1px solid #333; display: inline-block; padding: 6px 10px; }
+details { margin-left: 18px; }
+summary { cursor: pointer; padding: 2px 0; }
+.level > summary { background: #E0EFFF; }
+.key > summary { background: #F0F8FF; }
+.count { color: #666; }
+ul { margin: 2px 0 2px 18px; padding-left: 18px; }
+li.item { list-style: circle; background: #FFE6E6; display: table; padding: 0 6px; }
+input { margin: 10px 0; width: 320px; }
+</style>
+</head>
+<body>
+`
+
+const dumpHTMLScript = `<script>
+document.getElementById("filter").addEventListener("input", function (e) {
+  var q = e.target.value.toLowerCase();
+  document.querySelectorAll("details.key").forEach(function (d) {
+    d.style.display = d.dataset.key.toLowerCase().indexOf(q) >= 0 ? "" : "none";
+  });
+});
+</script>
+</body>
+</html>
+`
+
+// writeHTML writes a self-contained page with one expandable node per level and key and
+// a filter on key names.
+func (g *dumpGraph) writeHTML(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(dumpHTMLHead)
+	fmt.Fprintf(b, "<div class=\"stats\"><b>DataStore Statistics</b><br>Total Keys: %s<br>Total Items: %d</div>\n", g.keyCount(), g.items)
+	b.WriteString("<div><input id=\"filter\" type=\"search\" placeholder=\"Filter keys\"></div>\n")
+	b.WriteString("<h3>Composite Keys</h3>\n")
+	for _, level := range g.root.children {
+		fmt.Fprintf(b, "<details class=\"level\" open><summary>%s <span class=\"count\">(%d keys)</span></summary>\n",
+			html.EscapeString(level.lines[0]), len(level.children))
+		for _, key := range level.children {
+			k := html.EscapeString(key.id)
+			fmt.Fprintf(b, "<details class=\"key\" data-key=\"%s\"><summary>%s <span class=\"count\">(%d items)</span></summary>\n<ul>\n",
+				k, k, key.count)
+			for _, id := range key.sample {
+				fmt.Fprintf(b, "<li class=\"item\">%s</li>\n", html.EscapeString(id))
+			}
+			if more := key.count - len(key.sample); more > 0 {
+				fmt.Fprintf(b, "<li>and %d more</li>\n", more)
+			}
+			b.WriteString("</ul>\n</details>\n")
+		}
+		b.WriteString("</details>\n")
+	}
+	b.WriteString(dumpHTMLScript)
+	return b.Flush()
+}
@@ -0,0 +1,171 @@
+package matrixsearch
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"unicode/utf8"
+)
+
+// Layout of the SVG image, in pixels.
+const (
+	svgMargin     = 20.0
+	svgCharWidth  = 6.5
+	svgLineHeight = 14.0
+	svgPadding    = 10.0
+	svgNodeGap    = 12.0
+	svgRankGap    = 50.0
+)
+
+var svgFills = map[dumpKind]string{
+	dumpStats:    "#E6E6FA",
+	dumpCategory: "#D0E0FF",
+	dumpLevel:    "#E0EFFF",
+	dumpKey:      "#F0F8FF",
+	dumpItem:     "#FFE6E6",
+	dumpItems:    "#FFEFEF",
+}
+
+// writeSVG lays the graph out as a tree, one rank per depth with each parent centred
+// over its children, and writes it as SVG.
+func (g *dumpGraph) writeSVG(w io.Writer) error {
+	stats := &dumpNode{id: "stats", kind: dumpStats, lines: []string{
+		"DataStore Statistics",
+		"Total Keys: " + g.keyCount(),
+		fmt.Sprintf("Total Items: %d", g.items),
+	}}
+	measure(stats)
+	measureTree(g.root)
+
+	var rankHeights []float64
+	rankHeight(g.root, 0, &rankHeights)
+	// The key category shares the top rank with the statistics node.
+	if stats.h > rankHeights[0] {
+		rankHeights[0] = stats.h
+	}
+	rankY := make([]float64, len(rankHeights))
+	top := svgMargin
+	for i, h := range rankHeights {
+		rankY[i] = top
+		top += h + svgRankGap
+	}
+	right := place(g.root, 0, svgMargin+stats.w+svgNodeGap, rankY)
+	stats.x, stats.y = svgMargin, svgMargin
+	width := right + svgMargin
+	height := top - svgRankGap + svgMargin
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\" font-family=\"Arial\" font-size=\"11\">\n",
+		width, height, width, height)
+	b.WriteString("<defs><marker id=\"arrow\" viewBox=\"0 0 10 10\" refX=\"10\" refY=\"5\" markerWidth=\"6\" markerHeight=\"6\" orient=\"auto\"><path d=\"M0,0 L10,5 L0,10 z\" fill=\"#333\"/></marker></defs>\n")
+	b.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+	writeSVGEdges(b, g.root)
+	writeSVGNode(b, stats)
+	writeSVGNodes(b, g.root)
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
+
+func measure(n *dumpNode) {
+	chars := 0
+	for _, line := range n.lines {
+		if c := utf8.RuneCountInString(line); c > chars {
+			chars = c
+		}
+	}
+	n.w = float64(chars)*svgCharWidth + 2*svgPadding
+	n.h = float64(len(n.lines))*svgLineHeight + svgPadding
+}
+
+func measureTree(n *dumpNode) {
+	measure(n)
+	for _, c := range n.children {
+		measureTree(c)
+	}
+}
+
+func rankHeight(n *dumpNode, depth int, heights *[]float64) {
+	if depth == len(*heights) {
+		*heights = append(*heights, 0)
+	}
+	if n.h > (*heights)[depth] {
+		(*heights)[depth] = n.h
+	}
+	for _, c := range n.children {
+		rankHeight(c, depth+1, heights)
+	}
+}
+
+// place positions the subtree of n starting at x and returns its right edge.
+func place(n *dumpNode, depth int, x float64, rankY []float64) float64 {
+	n.y = rankY[depth]
+	if len(n.children) == 0 {
+		n.x = x
+		return x + n.w
+	}
+	right := x
+	for i, c := range n.children {
+		if i > 0 {
+			right += svgNodeGap
+		}
+		right = place(c, depth+1, right, rankY)
+	}
+	first, last := n.children[0], n.children[len(n.children)-1]
+	n.x = (first.x+last.x+last.w)/2 - n.w/2
+	if n.x < x {
+		// The node is wider than its children: shift them under it.
+		shift(n.children, x-n.x)
+		right += x - n.x
+		n.x = x
+	}
+	if n.x+n.w > right {
+		right = n.x + n.w
+	}
+	return right
+}
+
+func shift(nodes []*dumpNode, dx float64) {
+	for _, n := range nodes {
+		n.x += dx
+		shift(n.children, dx)
+	}
+}
+
+func writeSVGEdges(b *bufio.Writer, n *dumpNode) {
+	for _, c := range n.children {
+		fmt.Fprintf(b, "<line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#333\" marker-end=\"url(#arrow)\"/>\n",
+			n.x+n.w/2, n.y+n.h, c.x+c.w/2, c.y)
+		writeSVGEdges(b, c)
+	}
+}
+
+func writeSVGNodes(b *bufio.Writer, n *dumpNode) {
+	writeSVGNode(b, n)
+	for _, c := range n.children {
+		writeSVGNodes(b, c)
+	}
+}
+
+func writeSVGNode(b *bufio.Writer, n *dumpNode) {
+	fill := svgFills[n.kind]
+	switch n.kind {
+	case dumpItem:
+		fmt.Fprintf(b, "<ellipse cx=\"%.1f\" cy=\"%.1f\" rx=\"%.1f\" ry=\"%.1f\" fill=\"%s\" stroke=\"#333\"/>\n",
+			n.x+n.w/2, n.y+n.h/2, n.w/2, n.h/2, fill)
+	case dumpKey:
+		fmt.Fprintf(b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" rx=\"6\" fill=\"%s\" stroke=\"#333\"/>\n",
+			n.x, n.y, n.w, n.h, fill)
+	default:
+		fmt.Fprintf(b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\" stroke=\"#333\"/>\n",
+			n.x, n.y, n.w, n.h, fill)
+	}
+	for i, line := range n.lines {
+		weight := ""
+		if i == 0 && (n.kind == dumpStats || n.kind == dumpCategory) {
+			weight = " font-weight=\"bold\""
+		}
+		fmt.Fprintf(b, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\"%s>%s</text>\n",
+			n.x+n.w/2, n.y+svgPadding/2+float64(i+1)*svgLineHeight-3, weight, html.EscapeString(line))
+	}
+}
@@ -100,7 +100,7 @@ func autoCarExample() {
 		":brand:" + car.Brand +
 		":year:" + strconv.Itoa(car.Year) +
 		":color:" + car.Color +
-		":country:" + car.Manufacturer.Country
+		":manufacturer.country:" + car.Manufacturer.Country
 	fmt.Println("Auto Query:", query)
 	results := ds.Search(query)
 	if len(results) > 0 {
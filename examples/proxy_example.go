@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/xvertile/matrixsearch"
 	"math/rand"
@@ -133,11 +134,17 @@ func autoProxyExample() {
 	ds := matrixsearch.NewDataStore(func(p Proxy) string { return p.ID }, matrixsearch.AutoIndexer[Proxy])
 	proxy := randomProxy(2020)
 	ds.Insert(proxy)
-	query := "speedtype:" + proxy.SpeedType +
-		":mobile:" + strconv.FormatBool(proxy.Mobile) +
-		":country:" + proxy.Geo.Country
-	fmt.Println("Auto Query:", query)
-	results := ds.Search(query)
+	query := matrixsearch.Q().
+		Eq("speedtype", proxy.SpeedType).
+		Eq("mobile", proxy.Mobile).
+		Eq("country", proxy.Geo.Country)
+	keys, _ := ds.Compile(query)
+	fmt.Println("Auto Query:", keys)
+	results, err := ds.Query(query)
+	if err != nil {
+		fmt.Println("Query failed:", err)
+		return
+	}
 	if len(results) > 0 {
 		for _, r := range results {
 			fmt.Printf("Found Proxy: %+v\n", r)
@@ -149,11 +156,16 @@ func autoProxyExample() {
 
 func bulkProxyExample() {
 	fmt.Println("=== Proxy Bulk Example ===")
-	ds := matrixsearch.NewDataStore(func(p Proxy) string { return p.IP }, strictProxyIndexer)
+	ds := matrixsearch.NewDataStore(func(p Proxy) string { return p.ID }, strictProxyIndexer, matrixsearch.WithIndexes(
+		matrixsearch.UniqueIndex("ip", func(p Proxy) string { return p.IP }).OnConflict(matrixsearch.ConflictReject),
+	))
+	duplicates := 0
 	for i := 0; i < 100; i++ {
-		ds.Insert(randomProxy(i))
+		if err := ds.Insert(randomProxy(i)); errors.Is(err, matrixsearch.ErrDuplicate) {
+			duplicates++
+		}
 	}
-	fmt.Println("Total Proxies Inserted:", 100)
+	fmt.Println("Total Proxies Inserted:", ds.Count(), "duplicate IPs skipped:", duplicates)
 	query := "speedtype:fast"
 	fmt.Println("Bulk Query:", query)
 	results := ds.Search(query)
@@ -166,6 +178,10 @@ func bulkProxyExample() {
 		fmt.Printf("Random Proxy: %+v\n", r)
 	} else {
 		fmt.Println("SearchRandom found no proxy")
+		return
+	}
+	if p, ok := ds.GetBy("ip", r.IP); ok {
+		fmt.Printf("Proxy by IP %s: %s\n", r.IP, p.ID)
 	}
 }
 
@@ -0,0 +1,173 @@
+package matrixsearch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Plan describes how a Search query is resolved, for finding out why it returns what it
+// does. Build one with DataStore.Explain.
+type Plan struct {
+	// Query is the query as given and Key the stored key it is looked up under, after
+	// the separator and normalizers are applied.
+	Query string
+	Key   string
+	// Terms are the field:value pairs of the query, in query order.
+	Terms []PlanTerm
+	// Strategy is how Search finds the results: "composite" when it reads the
+	// precomputed key, "intersection" when it intersects the posting lists in Order, and
+	// "none" when it finds nothing.
+	Strategy string
+	// Order lists the keys an intersection visits, smallest posting list first. With
+	// every combination materialized these are the query's terms.
+	Order []string
+	// Composite reports whether Key is a precomputed composite key.
+	Composite bool
+	// Canonical is the query with its terms in the order the indexer emits them, when
+	// that differs from Key.
+	Canonical string
+	// Estimated is the number of results expected from the term sizes, assuming the
+	// fields are independent. Actual is the number Search returns and Matching the
+	// number of items that hold every term.
+	Estimated int
+	Actual    int
+	Matching  int
+	// Reason explains the outcome in one sentence.
+	Reason string
+}
+
+// PlanTerm is one field:value pair of a query.
+type PlanTerm struct {
+	Field string
+	Value string
+	// Known reports whether any item has a value for Field.
+	Known bool
+	// Items is the length of the term's posting list.
+	Items int
+}
+
+// Explain returns the plan for query: the terms it is made of, their posting list
+// sizes, whether it hits a precomputed key and how many items it finds, with a reason
+// when it finds none.
+func (ds *DataStore[T]) Explain(query string) *Plan {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	p := &Plan{Query: query, Key: ds.opts.searchKey(query)}
+	ids, ok := ds.compositeIndex[p.Key]
+	p.Composite = ok
+	p.Actual = len(ids)
+
+	parts := keyParts(p.Key)
+	if p.Key == "" || len(parts)%2 != 0 {
+		p.Reason = "the query is not a list of field:value pairs"
+		return p
+	}
+	keys := make([]string, 0, len(parts)/2)
+	for i := 0; i < len(parts); i += 2 {
+		field := unescape(parts[i])
+		_, known := ds.fieldRank[field]
+		key := parts[i] + ":" + parts[i+1]
+		p.Terms = append(p.Terms, PlanTerm{Field: field, Value: unescape(parts[i+1]), Known: known, Items: len(ds.compositeIndex[key])})
+		keys = append(keys, key)
+	}
+
+	order := make([]int, len(p.Terms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return p.Terms[order[a]].Items < p.Terms[order[b]].Items })
+	estimate := float64(len(ds.items))
+	termSteps := make([]planStep, len(order))
+	for j, i := range order {
+		termSteps[j] = planStep{key: keys[i], ids: ds.compositeIndex[keys[i]]}
+		if len(ds.items) > 0 {
+			estimate *= float64(p.Terms[i].Items) / float64(len(ds.items))
+		}
+	}
+	p.Estimated = int(math.Round(estimate))
+	p.Matching = len(intersect(termSteps, ds.keysLocked))
+
+	steps := termSteps
+	if !p.Composite && ds.opts.combinations != nil {
+		steps = ds.opts.planIntersection(p.Key, ds.indexedLocked)
+		p.Actual = len(intersect(steps, ds.keysLocked))
+	}
+	for _, s := range steps {
+		p.Order = append(p.Order, s.key)
+	}
+	switch {
+	case p.Actual == 0:
+		p.Strategy = "none"
+	case p.Composite:
+		p.Strategy = "composite"
+	default:
+		p.Strategy = "intersection"
+	}
+
+	ranked := make([]int, len(p.Terms))
+	for i := range ranked {
+		ranked[i] = i
+	}
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ds.fieldRank[p.Terms[ranked[a]].Field] < ds.fieldRank[p.Terms[ranked[b]].Field]
+	})
+	canonical := make([]string, len(ranked))
+	for j, i := range ranked {
+		canonical[j] = keys[i]
+	}
+	if c := strings.Join(canonical, ":"); c != p.Key {
+		p.Canonical = c
+	}
+	p.Reason = p.reason()
+	return p
+}
+
+func (p *Plan) reason() string {
+	for _, t := range p.Terms {
+		if !t.Known {
+			return fmt.Sprintf("no item has a field %q; check the spelling", t.Field)
+		}
+	}
+	for _, t := range p.Terms {
+		if t.Items == 0 {
+			return fmt.Sprintf("no item has %s %q", t.Field, t.Value)
+		}
+	}
+	switch {
+	case p.Actual > 0 && p.Strategy == "intersection":
+		return fmt.Sprintf("%d items found by intersecting %d posting lists", p.Actual, len(p.Order))
+	case p.Actual > 0:
+		return fmt.Sprintf("the composite key holds %d items", p.Actual)
+	case p.Matching > 0 && p.Canonical != "":
+		return fmt.Sprintf("%d items match, but the terms are out of indexer order; search for %q", p.Matching, p.Canonical)
+	case p.Matching > 0:
+		return fmt.Sprintf("%d items match every term, but the combination is not indexed", p.Matching)
+	}
+	return "every term has items, but no item has all of them"
+}
+
+// String renders the plan as indented text.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "query %q -> key %q\n", p.Query, p.Key)
+	for _, t := range p.Terms {
+		known := ""
+		if !t.Known {
+			known = " (unknown field)"
+		}
+		fmt.Fprintf(&b, "  term %s=%s: %d items%s\n", t.Field, t.Value, t.Items, known)
+	}
+	fmt.Fprintf(&b, "  strategy: %s\n", p.Strategy)
+	if len(p.Order) > 0 {
+		fmt.Fprintf(&b, "  intersection order: %s\n", strings.Join(p.Order, ", "))
+	}
+	fmt.Fprintf(&b, "  composite key: %t\n", p.Composite)
+	if p.Canonical != "" {
+		fmt.Fprintf(&b, "  indexer order: %s\n", p.Canonical)
+	}
+	fmt.Fprintf(&b, "  estimated %d, actual %d, matching %d\n", p.Estimated, p.Actual, p.Matching)
+	fmt.Fprintf(&b, "  %s\n", p.Reason)
+	return b.String()
+}
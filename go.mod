@@ -1,5 +1,7 @@
 module github.com/xvertile/matrixsearch
 
-go 1.20
+go 1.21
 
 require github.com/bxcodec/faker/v3 v3.8.1
+
+require golang.org/x/text v0.21.0
@@ -0,0 +1,106 @@
+package matrixsearch
+
+import "time"
+
+// Hooks observes the operations of a DataStore. Register them with WithHooks.
+//
+// OnInsert and OnDelete run after the write lock is released, once per item and in the
+// order of the writes, so they may call back into the store. Replacing an item reports
+// an insert only, Clear reports nothing and a rolled back Txn reports nothing. OnSearch
+// runs after each Search, SearchRandom, Query and QueryRandom with the number of items
+// returned. OnError receives the errors returned by the store, named by operation.
+// Hooks are called concurrently and must be safe for concurrent use.
+type Hooks interface {
+	OnInsert(id string)
+	OnDelete(id string)
+	OnSearch(query string, hits int, dur time.Duration)
+	OnError(op string, err error)
+}
+
+// NopHooks implements Hooks with methods that do nothing. Embed it to implement only
+// some of the hooks.
+type NopHooks struct{}
+
+func (NopHooks) OnInsert(id string)                                 {}
+func (NopHooks) OnDelete(id string)                                 {}
+func (NopHooks) OnSearch(query string, hits int, dur time.Duration) {}
+func (NopHooks) OnError(op string, err error)                       {}
+
+// WithHooks registers h on the store. Several hooks can be registered and are called in
+// the order they were given.
+func WithHooks(h Hooks) Option {
+	return func(o *options) {
+		switch prev := o.hooks.(type) {
+		case nil:
+			o.hooks = h
+		case multiHooks:
+			o.hooks = append(prev, h)
+		default:
+			o.hooks = multiHooks{prev, h}
+		}
+	}
+}
+
+type multiHooks []Hooks
+
+func (m multiHooks) OnInsert(id string) {
+	for _, h := range m {
+		h.OnInsert(id)
+	}
+}
+
+func (m multiHooks) OnDelete(id string) {
+	for _, h := range m {
+		h.OnDelete(id)
+	}
+}
+
+func (m multiHooks) OnSearch(query string, hits int, dur time.Duration) {
+	for _, h := range m {
+		h.OnSearch(query, hits, dur)
+	}
+}
+
+func (m multiHooks) OnError(op string, err error) {
+	for _, h := range m {
+		h.OnError(op, err)
+	}
+}
+
+// hookEvent is an insert or delete waiting to be reported.
+type hookEvent struct {
+	id      string
+	deleted bool
+}
+
+// emitLocked queues an insert or delete of id for the hooks.
+func (ds *DataStore[T]) emitLocked(id string, deleted bool) {
+	if ds.opts.hooks != nil {
+		ds.events = append(ds.events, hookEvent{id: id, deleted: deleted})
+	}
+}
+
+func (o *options) runHooks(events []hookEvent) {
+	for _, e := range events {
+		if e.deleted {
+			o.hooks.OnDelete(e.id)
+		} else {
+			o.hooks.OnInsert(e.id)
+		}
+	}
+}
+
+// reportError passes a non-nil err to the OnError hook and returns it.
+func (o *options) reportError(op string, err error) error {
+	if err != nil && o.hooks != nil {
+		o.hooks.OnError(op, err)
+	}
+	return err
+}
+
+func hitCount(ok bool) int {
+	if ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+// Package hooks provides matrixsearch.Hooks adapters for log/slog and for
+// OpenTelemetry-style tracing.
+//
+// Both adapters record the function that called into the store, so slow searches can be
+// traced back to their callers.
+package hooks
+
+import (
+	"runtime"
+	"strings"
+)
+
+// internalPrefixes are the packages skipped when looking for the caller of a store
+// operation.
+var internalPrefixes = []string{
+	"github.com/xvertile/matrixsearch.",
+	"github.com/xvertile/matrixsearch/hooks.",
+	"github.com/xvertile/matrixsearch/metrics.",
+	"runtime.",
+}
+
+// caller returns the first stack frame outside matrixsearch, which is the code that
+// called the store.
+func caller() runtime.Frame {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !internal(f.Function) {
+			return f
+		}
+		if !more {
+			return runtime.Frame{}
+		}
+	}
+}
+
+func internal(function string) bool {
+	for _, p := range internalPrefixes {
+		if strings.HasPrefix(function, p) {
+			return true
+		}
+	}
+	return false
+}
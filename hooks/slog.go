@@ -0,0 +1,53 @@
+package hooks
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/xvertile/matrixsearch"
+)
+
+// Slog returns hooks that log store operations to logger. Inserts, deletes and searches
+// are logged at debug level, searches taking at least slow at warn level, and errors at
+// error level. A slow of 0 never logs searches as slow.
+func Slog(logger *slog.Logger, slow time.Duration) matrixsearch.Hooks {
+	return &slogHooks{logger: logger, slow: slow}
+}
+
+type slogHooks struct {
+	logger *slog.Logger
+	slow   time.Duration
+}
+
+func (h *slogHooks) OnInsert(id string) {
+	h.log(slog.LevelDebug, "matrixsearch insert", slog.String("id", id))
+}
+
+func (h *slogHooks) OnDelete(id string) {
+	h.log(slog.LevelDebug, "matrixsearch delete", slog.String("id", id))
+}
+
+func (h *slogHooks) OnSearch(query string, hits int, dur time.Duration) {
+	level, msg := slog.LevelDebug, "matrixsearch search"
+	if h.slow > 0 && dur >= h.slow {
+		level, msg = slog.LevelWarn, "matrixsearch slow search"
+	}
+	h.log(level, msg, slog.String("query", query), slog.Int("hits", hits), slog.Duration("duration", dur))
+}
+
+func (h *slogHooks) OnError(op string, err error) {
+	h.log(slog.LevelError, "matrixsearch error", slog.String("op", op), slog.Any("error", err))
+}
+
+func (h *slogHooks) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	if !h.logger.Enabled(ctx, level) {
+		return
+	}
+	if f := caller(); f.Function != "" {
+		attrs = append(attrs, slog.String("caller", f.Function), slog.String("source", f.File+":"+strconv.Itoa(f.Line)))
+	}
+	h.logger.LogAttrs(ctx, level, msg, attrs...)
+}
@@ -0,0 +1,100 @@
+package hooks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xvertile/matrixsearch"
+)
+
+// SpanData is a finished span, shaped after OpenTelemetry's: a name, start and end
+// times, attributes named after the OpenTelemetry semantic conventions and the error
+// the operation failed with, if any.
+type SpanData struct {
+	Name       string
+	Start, End time.Time
+	Attributes map[string]any
+	Err        error
+}
+
+// SpanExporter receives the spans recorded by Tracing. To forward them to
+// OpenTelemetry, start a span with Start as its timestamp, set the attributes and end it
+// at End.
+type SpanExporter interface {
+	ExportSpan(SpanData)
+}
+
+// Tracing returns hooks that record one span per store operation and pass it to exp.
+// Search spans carry the query as db.statement and the number of hits; every span
+// carries the calling function as code.function, code.filepath and code.lineno.
+func Tracing(exp SpanExporter) matrixsearch.Hooks {
+	return &tracingHooks{exp: exp}
+}
+
+type tracingHooks struct {
+	exp SpanExporter
+}
+
+func (h *tracingHooks) OnInsert(id string) {
+	now := time.Now()
+	h.export("matrixsearch.insert", now, now, nil, "matrixsearch.id", id)
+}
+
+func (h *tracingHooks) OnDelete(id string) {
+	now := time.Now()
+	h.export("matrixsearch.delete", now, now, nil, "matrixsearch.id", id)
+}
+
+func (h *tracingHooks) OnSearch(query string, hits int, dur time.Duration) {
+	end := time.Now()
+	h.export("matrixsearch.search", end.Add(-dur), end, nil, "db.statement", query, "matrixsearch.hits", hits)
+}
+
+func (h *tracingHooks) OnError(op string, err error) {
+	now := time.Now()
+	h.export("matrixsearch."+op, now, now, err)
+}
+
+func (h *tracingHooks) export(name string, start, end time.Time, err error, attrs ...any) {
+	span := SpanData{Name: name, Start: start, End: end, Err: err, Attributes: map[string]any{"db.system": "matrixsearch"}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		span.Attributes[attrs[i].(string)] = attrs[i+1]
+	}
+	if f := caller(); f.Function != "" {
+		span.Attributes["code.function"] = f.Function
+		span.Attributes["code.filepath"] = f.File
+		span.Attributes["code.lineno"] = f.Line
+	}
+	h.exp.ExportSpan(span)
+}
+
+// InMemoryExporter keeps exported spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter returns an empty exporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns a copy of the spans exported so far.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops the spans exported so far.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,104 @@
+package matrixsearch
+
+import "strings"
+
+// Keys are stored as field:value pairs joined by ':'. A ':' or '\' inside a field or a
+// value is escaped with a backslash, so a value such as UTC+05:30 cannot be mistaken for
+// the start of another pair. Values without those characters are stored unchanged.
+// Indexers may already escape the field of a key, as AutoIndexer does for map entry
+// names; the value of an indexer key is always taken literally.
+
+// Escape escapes s for use as a field or value in a Search query, e.g.
+// "timezone:" + Escape("UTC+05:30").
+func Escape(s string) string {
+	if !strings.ContainsAny(s, `\:`) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' || s[i] == ':' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// unescape reverses Escape. A backslash makes the following byte literal.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// encodeKey turns an indexer key field:value into its stored form. The field ends at
+// the first ':' that is not escaped; everything after it is the value.
+func encodeKey(key string) string {
+	field, value, ok := cutKey(key)
+	if !ok {
+		return Escape(unescape(key))
+	}
+	if !strings.ContainsAny(value, `\:`) && !strings.Contains(field, `\`) {
+		return key
+	}
+	return Escape(unescape(field)) + ":" + Escape(value)
+}
+
+// cutKey splits key at the first ':' that is not escaped with a backslash. The field and
+// value are returned as they appear in key.
+func cutKey(key string) (field, value string, ok bool) {
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\':
+			i++
+		case ':':
+			return key[:i], key[i+1:], true
+		}
+	}
+	return key, "", false
+}
+
+// splitKey splits a stored single-pair key into its unescaped field and value.
+func splitKey(key string) (field, value string) {
+	field, value, _ = cutKey(key)
+	return unescape(field), unescape(value)
+}
+
+// searchKey converts a query passed to Search into the stored key form, applying the
+// configured separator and normalizers.
+func (o *options) searchKey(query string) string {
+	return o.normalizeQuery(splitQuery(query, o.separator))
+}
+
+// splitQuery converts a human-facing query that separates fields and values with sep into
+// the stored key form. The default separator ':' is the stored form already.
+func splitQuery(query, sep string) string {
+	if sep == "" || sep == ":" {
+		return query
+	}
+	var parts []string
+	start := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(query[i:], sep) {
+			parts = append(parts, Escape(unescape(query[start:i])))
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+	parts = append(parts, Escape(unescape(query[start:])))
+	return strings.Join(parts, ":")
+}
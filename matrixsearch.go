@@ -1,38 +1,94 @@
-// Updated matrixsearch.go
 package matrixsearch
 
 import (
-	"fmt"
+	"math/bits"
 	"math/rand"
-	"os/exec"
 	"reflect"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type DataStore[T any] struct {
-	mu             sync.RWMutex
-	items          map[string]T
+	mu       sync.RWMutex
+	items    map[string]T
+	itemKeys map[string][]string
+	versions map[string]uint64
+	clock    uint64
+	// compositeIndex maps each composite key to its posting list. Posting lists are only
+	// ever appended to; removals build a new slice, so published snapshots can share them.
 	compositeIndex map[string][]string
 	getID          func(T) string
 	indexer        func(T) []string
+	opts           options
+	// fieldRank records the order in which fields appear in indexer output, and
+	// fieldValues counts the items holding each value of a field. fieldNumbers keeps the
+	// values of a field that are numbers in ascending order, for range terms. All back
+	// Query.
+	fieldRank    map[string]int
+	fieldValues  map[string]map[string]int
+	fieldNumbers map[string]*rangeList
+
+	gen            uint64
+	snap           atomic.Pointer[Snapshot[T]]
+	dirtyIDs       map[string]struct{}
+	dirtyKeys      map[string]struct{}
+	rebuildAll     bool
+	publishPending bool
+	// events holds the inserts and deletes of the current write, reported to the hooks
+	// once the lock is released.
+	events []hookEvent
+	// indexes are the secondary indexes registered with WithIndexes, by name and in
+	// registration order.
+	indexes    map[string]*schemaIndex[T]
+	indexOrder []*schemaIndex[T]
 }
 
-func NewDataStore[T any](getID func(T) string, indexer func(T) []string) *DataStore[T] {
-	return &DataStore[T]{
+func NewDataStore[T any](getID func(T) string, indexer func(T) []string, opts ...Option) *DataStore[T] {
+	ds := &DataStore[T]{
 		items:          make(map[string]T),
+		itemKeys:       make(map[string][]string),
+		versions:       make(map[string]uint64),
 		compositeIndex: make(map[string][]string),
 		getID:          getID,
 		indexer:        indexer,
+		dirtyIDs:       make(map[string]struct{}),
+		dirtyKeys:      make(map[string]struct{}),
+		fieldRank:      make(map[string]int),
+		fieldValues:    make(map[string]map[string]int),
+		fieldNumbers:   make(map[string]*rangeList),
 	}
+	for _, opt := range opts {
+		opt(&ds.opts)
+	}
+	for field, fns := range typeNormalizers(reflect.TypeOf((*T)(nil)).Elem()) {
+		if _, ok := ds.opts.normalizers[field]; !ok {
+			WithNormalizer(field, fns...)(&ds.opts)
+		}
+	}
+	ds.buildIndexes()
+	if ds.opts.snapshotReads {
+		ds.snap.Store(ds.buildSnapshotLocked())
+	}
+	return ds
 }
 
+// getCombinations encodes the indexer keys and returns every non-empty subset of them
+// joined by ':', keeping the indexer's order within each subset. The single keys come
+// first.
 func getCombinations(keys []string) []string {
-	var combs []string
 	n := len(keys)
+	combs := make([]string, n, (1<<n)-1)
+	for i, key := range keys {
+		combs[i] = encodeKey(key)
+	}
+	keys = combs[:n]
 	for i := 1; i < (1 << n); i++ {
+		if bits.OnesCount(uint(i)) == 1 {
+			continue
+		}
 		var subset []string
 		for j := 0; j < n; j++ {
 			if i&(1<<j) != 0 {
@@ -44,26 +100,91 @@ func getCombinations(keys []string) []string {
 	return combs
 }
 
-func (ds *DataStore[T]) Insert(item T) {
+// combinations returns the normalized composite keys of item, or none without an
+// indexer.
+func (ds *DataStore[T]) combinations(item T) []string {
+	if ds.indexer == nil {
+		return nil
+	}
+	return ds.opts.combine(ds.opts.normalizeKeys(ds.indexer(item)))
+}
+
+// Insert stores item, replacing any item with the same ID. It fails with ErrDuplicate,
+// leaving the store unchanged, if item has a value held by another item on a unique
+// index that rejects duplicates.
+func (ds *DataStore[T]) Insert(item T) error {
+	return ds.opts.reportError("insert", ds.insert(item))
+}
+
+func (ds *DataStore[T]) insert(item T) error {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	return ds.insertLocked(item)
+}
+
+func (ds *DataStore[T]) Delete(item T) {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	ds.deleteLocked(ds.getID(item))
+}
+
+// DeleteByID removes the item stored under id. It reports whether an item was removed.
+func (ds *DataStore[T]) DeleteByID(id string) bool {
 	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	id := ds.getID(item)
+	defer ds.writeUnlock()
+	return ds.deleteLocked(id)
+}
+
+// insertLocked stores item and indexes it, replacing any item with the same ID.
+func (ds *DataStore[T]) insertLocked(item T) error {
+	return ds.putLocked(ds.getID(item), item, ds.combinations(item))
+}
+
+// putLocked stores item under id and indexes it under comps. The composite keys are
+// remembered so the item can later be removed by ID alone. Items holding one of its
+// unique values are deleted, unless their index rejects duplicates.
+func (ds *DataStore[T]) putLocked(id string, item T, comps []string) error {
+	holders, err := ds.uniqueHoldersLocked(id, item)
+	if err != nil {
+		return err
+	}
+	if _, ok := ds.items[id]; ok {
+		ds.unindexLocked(id)
+	}
+	for _, other := range holders {
+		ds.deleteLocked(other)
+	}
+	ds.emitLocked(id, false)
 	ds.items[id] = item
-	keys := ds.indexer(item)
-	comps := getCombinations(keys)
+	ds.itemKeys[id] = comps
+	ds.touchLocked(id, comps)
+	ds.countFieldsLocked(comps, 1)
+	ds.clock++
+	ds.versions[id] = ds.clock
 	for _, key := range comps {
 		ds.compositeIndex[key] = append(ds.compositeIndex[key], id)
 	}
+	ds.indexSchemaLocked(id, item)
+	return nil
 }
 
-func (ds *DataStore[T]) Delete(item T) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	id := ds.getID(item)
+// deleteLocked removes id from the items and from every posting list it was indexed under.
+func (ds *DataStore[T]) deleteLocked(id string) bool {
+	if _, ok := ds.items[id]; !ok {
+		return false
+	}
+	ds.unindexLocked(id)
+	ds.emitLocked(id, true)
+	return true
+}
+
+// unindexLocked removes the stored item id without reporting it to the hooks.
+func (ds *DataStore[T]) unindexLocked(id string) {
+	ds.unindexSchemaLocked(id, ds.items[id])
 	delete(ds.items, id)
-	keys := ds.indexer(item)
-	comps := getCombinations(keys)
-	for _, key := range comps {
+	ds.touchLocked(id, ds.itemKeys[id])
+	ds.countFieldsLocked(ds.itemKeys[id], -1)
+	for _, key := range ds.itemKeys[id] {
 		newIDs := []string{}
 		for _, itemID := range ds.compositeIndex[key] {
 			if itemID != id {
@@ -72,228 +193,221 @@ func (ds *DataStore[T]) Delete(item T) {
 		}
 		ds.compositeIndex[key] = newIDs
 	}
+	delete(ds.itemKeys, id)
+	delete(ds.versions, id)
 }
 
-func (ds *DataStore[T]) Search(query string) []T {
+// Get returns the item stored under id.
+func (ds *DataStore[T]) Get(id string) (T, bool) {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().Get(id)
+	}
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
-	if ids, ok := ds.compositeIndex[query]; ok {
-		var results []T
-		for _, id := range ids {
-			results = append(results, ds.items[id])
-		}
-		return results
-	}
-	return nil
+	item, ok := ds.items[id]
+	return item, ok
 }
 
-func (ds *DataStore[T]) SearchRandom(query string) (T, bool) {
+// GetWithVersion returns the item stored under id together with its version. The
+// version changes on every write to the item and can be passed to CompareAndSwap. With
+// snapshot reads it may be older than the stored version until the write is published,
+// and CompareAndSwap then fails.
+func (ds *DataStore[T]) GetWithVersion(id string) (T, uint64, bool) {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().GetWithVersion(id)
+	}
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
-	if ids, ok := ds.compositeIndex[query]; ok && len(ids) > 0 {
-		n := rand.Intn(len(ids))
-		return ds.items[ids[n]], true
-	}
-	var zero T
-	return zero, false
+	item, ok := ds.items[id]
+	return item, ds.versions[id], ok
 }
 
-func (ds *DataStore[T]) Update(item T) {
-	ds.Delete(item)
-	ds.Insert(item)
+// CompareAndSwap replaces the item stored under id with item only if its current
+// version equals expected. An expected version of 0 inserts item only if id is absent.
+// It reports whether the swap happened; item must have the ID id. A stale version is
+// not an error, but a value rejected by a unique index fails with ErrDuplicate.
+func (ds *DataStore[T]) CompareAndSwap(id string, expected uint64, item T) (bool, error) {
+	swapped, err := ds.compareAndSwap(id, expected, item)
+	return swapped, ds.opts.reportError("cas", err)
 }
 
-func (ds *DataStore[T]) Count() int {
+func (ds *DataStore[T]) compareAndSwap(id string, expected uint64, item T) (bool, error) {
+	if ds.getID(item) != id {
+		return false, nil
+	}
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	if ds.versions[id] != expected {
+		return false, nil
+	}
+	if err := ds.insertLocked(item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetMany returns the items stored under ids, in the same order. Unknown IDs are skipped.
+func (ds *DataStore[T]) GetMany(ids []string) []T {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().GetMany(ids)
+	}
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
-	return len(ds.items)
+	var results []T
+	for _, id := range ids {
+		if item, ok := ds.items[id]; ok {
+			results = append(results, item)
+		}
+	}
+	return results
 }
 
-func (ds *DataStore[T]) Clear() {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-	ds.items = make(map[string]T)
-	ds.compositeIndex = make(map[string][]string)
+// Has reports whether an item is stored under id.
+func (ds *DataStore[T]) Has(id string) bool {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().Has(id)
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	_, ok := ds.items[id]
+	return ok
 }
 
-func AutoIndexer[T any](item T) []string {
-	var keys []string
-	v := reflect.ValueOf(item)
-	keys = extractKeys(v)
-	return keys
+// IDs returns the IDs of all stored items in sorted order.
+func (ds *DataStore[T]) IDs() []string {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().IDs()
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	ids := make([]string, 0, len(ds.items))
+	for id := range ds.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
-func extractKeys(v reflect.Value) []string {
-	var keys []string
-	if v.Kind() == reflect.Pointer {
-		v = v.Elem()
-	}
-	if v.Kind() != reflect.Struct {
-		return keys
-	}
-	t := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		field := t.Field(i)
-		value := v.Field(i)
-		tag := field.Tag.Get("text")
-		if tag != "" {
-			var strVal string
-			switch value.Kind() {
-			case reflect.String:
-				strVal = value.String()
-			case reflect.Bool:
-				strVal = strconv.FormatBool(value.Bool())
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				strVal = strconv.FormatInt(value.Int(), 10)
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				strVal = strconv.FormatUint(value.Uint(), 10)
-			case reflect.Float32, reflect.Float64:
-				strVal = strconv.FormatFloat(value.Float(), 'f', -1, 64)
-			}
-			if strVal != "" {
-				keys = append(keys, tag+":"+strVal)
-			}
-		}
-		if value.Kind() == reflect.Struct {
-			subKeys := extractKeys(value)
-			keys = append(keys, subKeys...)
-		}
+// All returns every stored item, ordered by ID.
+func (ds *DataStore[T]) All() []T {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().All()
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	ids := make([]string, 0, len(ds.items))
+	for id := range ds.items {
+		ids = append(ids, id)
 	}
-	return keys
+	sort.Strings(ids)
+	results := make([]T, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, ds.items[id])
+	}
+	return results
 }
 
-// escapeDOT escapes double quotes in strings for DOT.
-func escapeDOT(s string) string {
-	return strings.ReplaceAll(s, "\"", "\\\"")
+func (ds *DataStore[T]) Search(query string) []T {
+	if ds.opts.hooks == nil {
+		return ds.search(query)
+	}
+	start := time.Now()
+	results := ds.search(query)
+	ds.opts.hooks.OnSearch(query, len(results), time.Since(start))
+	return results
 }
 
-/// Completely AI generated code below this line. No clue what it does but looks great!.
-
-func (ds *DataStore[T]) Dump(filename string) error {
+func (ds *DataStore[T]) search(query string) []T {
+	query = ds.opts.searchKey(query)
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().search(query)
+	}
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
+	return ds.searchLocked(query)
+}
 
-	var b strings.Builder
-	b.WriteString("digraph DataStore {\n")
-	b.WriteString("  // Basic settings\n")
-	b.WriteString("  rankdir=TB;\n")         // Top to bottom layout
-	b.WriteString("  splines=polyline;\n")   // Straight line segments
-	b.WriteString("  ranksep=0.8;\n")        // Spacing between ranks
-	b.WriteString("  nodesep=0.5;\n")        // Spacing between nodes
-	b.WriteString("  fontname=\"Arial\";\n") // Default font
-	b.WriteString("  node [fontname=\"Arial\", fontsize=11];\n")
-	b.WriteString("  edge [fontname=\"Arial\", fontsize=9, arrowsize=0.7];\n")
-
-	// Use HTML-like labels for better formatting
-	// Create a structured section for stats
-	totalKeys := len(ds.compositeIndex)
-
-	// Count unique items
-	itemSet := make(map[string]bool)
-	for _, ids := range ds.compositeIndex {
+func (ds *DataStore[T]) searchLocked(query string) []T {
+	if ids := ds.lookupLocked(query); ids != nil {
+		var results []T
 		for _, id := range ids {
-			itemSet[id] = true
+			results = append(results, ds.items[id])
 		}
+		return results
 	}
-	totalItems := len(itemSet)
-
-	// Add a stats header node
-	b.WriteString("  // Stats header node\n")
-	b.WriteString(fmt.Sprintf("  \"stats\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#E6E6FA\"><B>DataStore Statistics</B></TD></TR><TR><TD ALIGN=\"left\">Total Keys: %d</TD></TR><TR><TD ALIGN=\"left\">Total Items: %d</TD></TR></TABLE>>, fontsize=12];\n",
-		totalKeys, totalItems))
-
-	// Create a key category node
-	b.WriteString("  // Key category node\n")
-	b.WriteString("  \"keyCategory\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#D0E0FF\"><B>Composite Keys</B></TD></TR></TABLE>>, fontsize=12];\n")
-
-	// Connect stats to key category
-	b.WriteString("  \"stats\" -> \"keyCategory\" [style=invis];\n")
-
-	// Group keys by their length/complexity to create categories
-	keysByLength := make(map[int][]string)
+	return nil
+}
 
-	for key := range ds.compositeIndex {
-		// Count the number of components in each key
-		components := strings.Count(key, ":") + 1
-		keysByLength[components] = append(keysByLength[components], key)
+func (ds *DataStore[T]) SearchRandom(query string) (T, bool) {
+	if ds.opts.hooks == nil {
+		return ds.searchRandom(query)
 	}
+	start := time.Now()
+	item, ok := ds.searchRandom(query)
+	ds.opts.hooks.OnSearch(query, hitCount(ok), time.Since(start))
+	return item, ok
+}
 
-	// Sort the categories
-	var lengths []int
-	for length := range keysByLength {
-		lengths = append(lengths, length)
+func (ds *DataStore[T]) searchRandom(query string) (T, bool) {
+	query = ds.opts.searchKey(query)
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().searchRandom(query)
 	}
-	sort.Ints(lengths)
-
-	// Create key complexity level nodes
-	var complexityNodes []string
-	for _, length := range lengths {
-		nodeName := fmt.Sprintf("keyLevel_%d", length)
-		label := fmt.Sprintf("%d-Component Keys", length)
-		if length == 1 {
-			label = "Simple Keys"
-		}
-		b.WriteString(fmt.Sprintf("  \"%s\" [shape=plaintext, label=<<TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\"><TR><TD BGCOLOR=\"#E0EFFF\">%s</TD></TR></TABLE>>, fontsize=11];\n",
-			nodeName, label))
-		complexityNodes = append(complexityNodes, nodeName)
-
-		// Connect from key category
-		b.WriteString(fmt.Sprintf("  \"keyCategory\" -> \"%s\";\n", nodeName))
-
-		// Sort keys within this level for consistency
-		sort.Strings(keysByLength[length])
-
-		// Add individual key nodes
-		for _, key := range keysByLength[length] {
-			safeKey := escapeDOT(key)
-			count := len(ds.compositeIndex[key])
-
-			// Create a node for this key
-			b.WriteString(fmt.Sprintf("  \"%s\" [shape=box, style=\"rounded,filled\", fillcolor=\"#F0F8FF\", label=\"%s\\n(%d items)\"];\n",
-				safeKey, safeKey, count))
-
-			// Connect from the complexity level
-			b.WriteString(fmt.Sprintf("  \"%s\" -> \"%s\";\n", nodeName, safeKey))
-
-			// If this key has a reasonable number of items, show them directly
-			MAX_DIRECT_ITEMS := 5 // Limit for direct connections
-			ids := ds.compositeIndex[key]
-
-			if len(ids) <= MAX_DIRECT_ITEMS {
-				// Show all items directly
-				for _, id := range ids {
-					safeID := escapeDOT(id)
-					b.WriteString(fmt.Sprintf("  \"%s_item_%s\" [shape=ellipse, style=\"filled\", fillcolor=\"#FFE6E6\", label=\"%s\"];\n",
-						safeKey, safeID, safeID))
-					b.WriteString(fmt.Sprintf("  \"%s\" -> \"%s_item_%s\";\n", safeKey, safeKey, safeID))
-				}
-			} else {
-				// Create a collapsed node that can be expanded in interactive viewers
-				b.WriteString(fmt.Sprintf("  \"%s_items\" [shape=folder, style=\"filled\", fillcolor=\"#FFEFEF\", label=\"%d items\"];\n",
-					safeKey, len(ids)))
-				b.WriteString(fmt.Sprintf("  \"%s\" -> \"%s_items\";\n", safeKey, safeKey))
-			}
-		}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if ids := ds.lookupLocked(query); len(ids) > 0 {
+		n := rand.Intn(len(ids))
+		return ds.items[ids[n]], true
 	}
+	var zero T
+	return zero, false
+}
 
-	// Make sure all complexityNodes are in the same rank
-	if len(complexityNodes) > 1 {
-		b.WriteString("  { rank=same; ")
-		for _, node := range complexityNodes {
-			b.WriteString(fmt.Sprintf("\"%s\"; ", node))
-		}
-		b.WriteString("}\n")
+// matchCount returns the number of items matching query.
+func (ds *DataStore[T]) matchCount(query string) int {
+	query = ds.opts.searchKey(query)
+	if ds.opts.snapshotReads {
+		return len(ds.snap.Load().lookup(query))
 	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return len(ds.lookupLocked(query))
+}
 
-	// Ensure stats and key category are at the top
-	b.WriteString("  { rank=source; \"stats\"; \"keyCategory\"; }\n")
+// Update replaces the item with the same ID, or inserts it.
+func (ds *DataStore[T]) Update(item T) error {
+	return ds.opts.reportError("update", ds.insert(item))
+}
 
-	// Closing the DOT representation
-	b.WriteString("}\n")
+func (ds *DataStore[T]) Count() int {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load().Count()
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return len(ds.items)
+}
 
-	// Execute Graphviz command to generate the SVG output
-	dotStr := b.String()
-	cmd := exec.Command("dot", "-Tsvg", "-o", filename)
-	cmd.Stdin = strings.NewReader(dotStr)
-	return cmd.Run()
+// KeyCount returns the number of composite keys, including those whose items have all
+// been deleted. Unlike Stats it does not visit the index.
+func (ds *DataStore[T]) KeyCount() int {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return len(ds.compositeIndex)
+}
+
+func (ds *DataStore[T]) Clear() {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	ds.items = make(map[string]T)
+	ds.itemKeys = make(map[string][]string)
+	ds.versions = make(map[string]uint64)
+	ds.compositeIndex = make(map[string][]string)
+	ds.fieldRank = make(map[string]int)
+	ds.fieldValues = make(map[string]map[string]int)
+	ds.fieldNumbers = make(map[string]*rangeList)
+	for _, s := range ds.indexOrder {
+		s.reset()
+	}
+	ds.rebuildAll = true
 }
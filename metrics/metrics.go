@@ -0,0 +1,359 @@
+// Package metrics exports store metrics in the Prometheus text exposition format.
+//
+// Wrap a store with Instrument and serve the Registry over HTTP:
+//
+//	reg := metrics.NewRegistry()
+//	proxies := metrics.Instrument(reg, "proxies", matrixsearch.NewDataStore(getID, indexer))
+//	http.Handle("/metrics", reg)
+//
+// The wrapper times the writes, searches and queries of the store and counts search and
+// query hits and misses; every other method is passed through to the store. Item and key
+// counts are read from DataStore.Count and DataStore.KeyCount when the registry is
+// scraped. The estimated memory needs a walk of the whole index with DataStore.Stats
+// and is only exported for stores instrumented WithFullStats.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xvertile/matrixsearch"
+)
+
+// Operations timed by Store, used as the op label.
+var operations = []string{
+	"insert", "delete", "update", "search", "search_random",
+	"insert_many", "delete_many", "apply_batch", "txn", "compare_and_swap", "query", "query_random",
+}
+
+const (
+	opInsert = iota
+	opDelete
+	opUpdate
+	opSearch
+	opSearchRandom
+	opInsertMany
+	opDeleteMany
+	opApplyBatch
+	opTxn
+	opCompareAndSwap
+	opQuery
+	opQueryRandom
+	opCount
+)
+
+// lookups are the operations whose hits and misses are counted.
+var lookups = []int{opSearch, opSearchRandom, opQuery, opQueryRandom}
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms.
+var DefaultBuckets = []float64{
+	0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025,
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1,
+}
+
+// Registry holds the metrics of instrumented stores. It is an http.Handler serving them
+// in the Prometheus text exposition format.
+type Registry struct {
+	mu     sync.Mutex
+	stores map[string]*storeMetrics
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{stores: make(map[string]*storeMetrics)}
+}
+
+// storeMetrics holds the metrics of one store. items and keys read the store's cheap
+// gauges; stats is nil unless full stats were requested.
+type storeMetrics struct {
+	name    string
+	items   func() int
+	keys    func() int
+	stats   func() matrixsearch.Stats
+	latency [opCount]histogram
+	hits    [opCount]atomic.Uint64
+	misses  [opCount]atomic.Uint64
+}
+
+func (r *Registry) register(m *storeMetrics) *storeMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.stores[m.name]; ok {
+		panic(fmt.Sprintf("metrics: store %q registered twice", m.name))
+	}
+	for i := range m.latency {
+		m.latency[i].init(DefaultBuckets)
+	}
+	r.stores[m.name] = m
+	return m
+}
+
+// Store is a DataStore that records metrics in a Registry.
+type Store[T any] struct {
+	*matrixsearch.DataStore[T]
+	m *storeMetrics
+}
+
+// Option configures Instrument.
+type Option func(*options)
+
+type options struct {
+	fullStats bool
+}
+
+// WithFullStats makes every scrape call DataStore.Stats and export the estimated memory
+// of the store. Stats visits every posting list under the store's read lock, so scrapes
+// of a large store become slow.
+func WithFullStats() Option {
+	return func(o *options) { o.fullStats = true }
+}
+
+// Instrument registers ds in r under name and returns the wrapper recording its metrics.
+// The name is used as the store label and must be unique within r; Instrument panics
+// otherwise.
+func Instrument[T any](r *Registry, name string, ds *matrixsearch.DataStore[T], opts ...Option) *Store[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	m := &storeMetrics{name: name, items: ds.Count, keys: ds.KeyCount}
+	if o.fullStats {
+		m.stats = ds.Stats
+	}
+	return &Store[T]{DataStore: ds, m: r.register(m)}
+}
+
+// observe records the time elapsed since start for op.
+func (s *Store[T]) observe(op int, start time.Time) {
+	s.m.latency[op].observe(time.Since(start))
+}
+
+// found counts a hit or a miss for op.
+func (s *Store[T]) found(op int, hit bool) {
+	if hit {
+		s.m.hits[op].Add(1)
+	} else {
+		s.m.misses[op].Add(1)
+	}
+}
+
+func (s *Store[T]) Insert(item T) error {
+	defer s.observe(opInsert, time.Now())
+	return s.DataStore.Insert(item)
+}
+
+func (s *Store[T]) Delete(item T) {
+	defer s.observe(opDelete, time.Now())
+	s.DataStore.Delete(item)
+}
+
+func (s *Store[T]) Update(item T) error {
+	defer s.observe(opUpdate, time.Now())
+	return s.DataStore.Update(item)
+}
+
+func (s *Store[T]) InsertMany(items []T) error {
+	defer s.observe(opInsertMany, time.Now())
+	return s.DataStore.InsertMany(items)
+}
+
+func (s *Store[T]) DeleteMany(items []T) int {
+	defer s.observe(opDeleteMany, time.Now())
+	return s.DataStore.DeleteMany(items)
+}
+
+func (s *Store[T]) ApplyBatch(ops []matrixsearch.Op[T]) error {
+	defer s.observe(opApplyBatch, time.Now())
+	return s.DataStore.ApplyBatch(ops)
+}
+
+func (s *Store[T]) Txn(fn func(tx *matrixsearch.Txn[T]) error) error {
+	defer s.observe(opTxn, time.Now())
+	return s.DataStore.Txn(fn)
+}
+
+func (s *Store[T]) CompareAndSwap(id string, expected uint64, item T) (bool, error) {
+	defer s.observe(opCompareAndSwap, time.Now())
+	return s.DataStore.CompareAndSwap(id, expected, item)
+}
+
+func (s *Store[T]) Search(query string) []T {
+	start := time.Now()
+	results := s.DataStore.Search(query)
+	s.observe(opSearch, start)
+	s.found(opSearch, len(results) > 0)
+	return results
+}
+
+func (s *Store[T]) SearchRandom(query string) (T, bool) {
+	start := time.Now()
+	item, ok := s.DataStore.SearchRandom(query)
+	s.observe(opSearchRandom, start)
+	s.found(opSearchRandom, ok)
+	return item, ok
+}
+
+// Query and QueryRandom count a hit or a miss only when the query is valid.
+func (s *Store[T]) Query(q *matrixsearch.Query) ([]T, error) {
+	start := time.Now()
+	results, err := s.DataStore.Query(q)
+	s.observe(opQuery, start)
+	if err == nil {
+		s.found(opQuery, len(results) > 0)
+	}
+	return results, err
+}
+
+func (s *Store[T]) QueryRandom(q *matrixsearch.Query) (T, bool, error) {
+	start := time.Now()
+	item, ok, err := s.DataStore.QueryRandom(q)
+	s.observe(opQueryRandom, start)
+	if err == nil {
+		s.found(opQueryRandom, ok)
+	}
+	return item, ok, err
+}
+
+// histogram is a fixed-bucket latency histogram in seconds, safe for concurrent use.
+type histogram struct {
+	bounds []float64
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+func (h *histogram) init(bounds []float64) {
+	h.bounds = bounds
+	h.counts = make([]atomic.Uint64, len(bounds))
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes every metric of r to w in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	stores := make([]*storeMetrics, 0, len(r.stores))
+	for _, m := range r.stores {
+		stores = append(stores, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(stores, func(i, j int) bool { return stores[i].name < stores[j].name })
+	var full []*storeMetrics
+	var memory []int64
+	for _, m := range stores {
+		if m.stats != nil {
+			full = append(full, m)
+			memory = append(memory, m.stats().Memory.Total)
+		}
+	}
+
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+	family(b, "matrixsearch_items", "gauge", "Number of items in the store.")
+	for _, m := range stores {
+		sample(b, "matrixsearch_items", labels("store", m.name), float64(m.items()))
+	}
+	family(b, "matrixsearch_keys", "gauge", "Number of composite keys in the store.")
+	for _, m := range stores {
+		sample(b, "matrixsearch_keys", labels("store", m.name), float64(m.keys()))
+	}
+	if len(full) > 0 {
+		family(b, "matrixsearch_memory_bytes", "gauge", "Estimated memory held by the store.")
+		for i, m := range full {
+			sample(b, "matrixsearch_memory_bytes", labels("store", m.name), float64(memory[i]))
+		}
+	}
+	family(b, "matrixsearch_operation_duration_seconds", "histogram", "Latency of store operations.")
+	for _, m := range stores {
+		for op, name := range operations {
+			m.latency[op].write(b, "matrixsearch_operation_duration_seconds", labels("store", m.name, "op", name))
+		}
+	}
+	family(b, "matrixsearch_search_results_total", "counter", "Searches and queries by operation and by whether they found an item.")
+	for _, m := range stores {
+		for _, op := range lookups {
+			sample(b, "matrixsearch_search_results_total", labels("store", m.name, "op", operations[op], "result", "hit"), float64(m.hits[op].Load()))
+			sample(b, "matrixsearch_search_results_total", labels("store", m.name, "op", operations[op], "result", "miss"), float64(m.misses[op].Load()))
+		}
+	}
+	err := b.Flush()
+	return cw.n, err
+}
+
+func (h *histogram) write(b *bufio.Writer, name, lbls string) {
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		sample(b, name+"_bucket", lbls+`,le="`+formatFloat(bound)+`"`, float64(cumulative))
+	}
+	count := h.count.Load()
+	sample(b, name+"_bucket", lbls+`,le="+Inf"`, float64(count))
+	sample(b, name+"_sum", lbls, math.Float64frombits(h.sum.Load()))
+	sample(b, name+"_count", lbls, float64(count))
+}
+
+func family(b *bufio.Writer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(b *bufio.Writer, name, lbls string, v float64) {
+	fmt.Fprintf(b, "%s{%s} %s\n", name, lbls, formatFloat(v))
+}
+
+// labels renders name/value pairs as a label set without the braces.
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return strings.Join(parts, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,182 @@
+package matrixsearch
+
+import (
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer rewrites a field value before it is indexed or searched for, so that
+// spellings such as "US", "us" and " Us " end up under the same key.
+type Normalizer func(string) string
+
+// Lower maps s to lower case.
+func Lower(s string) string { return strings.ToLower(s) }
+
+// Upper maps s to upper case.
+func Upper(s string) string { return strings.ToUpper(s) }
+
+// Trim removes leading and trailing white space.
+func Trim(s string) string { return strings.TrimSpace(s) }
+
+// Fold applies Unicode case folding, which also equates forms such as "ß" and "ss".
+func Fold(s string) string { return cases.Fold().String(s) }
+
+// NFC converts s to Unicode normalization form C.
+func NFC(s string) string { return norm.NFC.String(s) }
+
+// NFKC converts s to Unicode normalization form KC.
+func NFKC(s string) string { return norm.NFKC.String(s) }
+
+// normalizersByName maps the tag options accepted after a text tag's name, as in
+// `text:"city,fold,trim"`, to their normalizers.
+var normalizersByName = map[string]Normalizer{
+	"lower": Lower,
+	"upper": Upper,
+	"trim":  Trim,
+	"fold":  Fold,
+	"nfc":   NFC,
+	"nfkc":  NFKC,
+}
+
+// WithNormalizer normalizes the values of field with fns, in order, both when items are
+// indexed and when queries are run. In queries it replaces the normalizers declared in
+// struct tags for the same field. AutoIndexer does not see the store's options and
+// applies the tag normalizers to the values it indexes before fns run, so fns can refine
+// them but not undo them. The values of a tagged map are addressed as field.*.
+func WithNormalizer(field string, fns ...Normalizer) Option {
+	return func(o *options) {
+		if o.normalizers == nil {
+			o.normalizers = make(map[string][]Normalizer)
+		}
+		o.normalizers[field] = fns
+	}
+}
+
+// parseTag splits a text tag into its key name and options.
+func parseTag(tag string) (string, []string) {
+	name, rest, ok := strings.Cut(tag, ",")
+	if !ok {
+		return name, nil
+	}
+	return name, strings.Split(rest, ",")
+}
+
+// tagNormalizers returns the normalizers named in opts. Unknown options are ignored.
+func tagNormalizers(opts []string) []Normalizer {
+	var fns []Normalizer
+	for _, opt := range opts {
+		if fn, ok := normalizersByName[opt]; ok {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
+
+func normalize(fns []Normalizer, s string) string {
+	for _, fn := range fns {
+		s = fn(s)
+	}
+	return s
+}
+
+// typeNormalizers collects the normalizers declared in the text tags of t, keyed by
+// field name as AutoIndexer names them.
+func typeNormalizers(t reflect.Type) map[string][]Normalizer {
+	found := make(map[string][]Normalizer)
+	collectNormalizers(t, "", map[reflect.Type]bool{}, found)
+	return found
+}
+
+func collectNormalizers(t reflect.Type, prefix string, path map[reflect.Type]bool, found map[string][]Normalizer) {
+	t, _ = derefType(t)
+	if t.Kind() != reflect.Struct || t == timeType || path[t] {
+		return
+	}
+	path[t] = true
+	defer delete(path, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts := parseTag(field.Tag.Get("text"))
+		if name == "-" {
+			continue
+		}
+		ft, _ := derefType(field.Type)
+		if ft.Kind() == reflect.Struct {
+			subPrefix := prefix
+			if name != "" {
+				subPrefix = prefix + name + "."
+			}
+			collectNormalizers(ft, subPrefix, path, found)
+			continue
+		}
+		fns := tagNormalizers(opts)
+		if name == "" || len(fns) == 0 {
+			continue
+		}
+		if ft.Kind() == reflect.Map {
+			found[prefix+name+".*"] = fns
+		} else {
+			found[prefix+name] = fns
+		}
+	}
+}
+
+// fieldNormalizers returns the normalizers for field, falling back to the entry of the
+// enclosing map field.
+func (o *options) fieldNormalizers(field string) []Normalizer {
+	if fns, ok := o.normalizers[field]; ok {
+		return fns
+	}
+	if i := strings.LastIndexByte(field, '.'); i >= 0 {
+		return o.normalizers[field[:i]+".*"]
+	}
+	return nil
+}
+
+// normalizeKeys normalizes the values of indexer keys of the form field:value.
+func (o *options) normalizeKeys(keys []string) []string {
+	if len(o.normalizers) == 0 {
+		return keys
+	}
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = key
+		if field, value, ok := cutKey(key); ok {
+			if fns := o.fieldNormalizers(unescape(field)); fns != nil {
+				out[i] = field + ":" + normalize(fns, value)
+			}
+		}
+	}
+	return out
+}
+
+// normalizeQuery normalizes the values of a query in stored key form.
+func (o *options) normalizeQuery(query string) string {
+	if len(o.normalizers) == 0 {
+		return query
+	}
+	var parts []string
+	start := 0
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case ':':
+			parts = append(parts, unescape(query[start:i]))
+			start = i + 1
+		}
+	}
+	parts = append(parts, unescape(query[start:]))
+	for i := 0; i+1 < len(parts); i += 2 {
+		if fns := o.fieldNormalizers(parts[i]); fns != nil {
+			parts[i+1] = normalize(fns, parts[i+1])
+		}
+	}
+	for i := range parts {
+		parts[i] = Escape(parts[i])
+	}
+	return strings.Join(parts, ":")
+}
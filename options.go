@@ -0,0 +1,44 @@
+package matrixsearch
+
+import "time"
+
+// Option configures a DataStore created by NewDataStore.
+type Option func(*options)
+
+type options struct {
+	snapshotReads   bool
+	publishInterval time.Duration
+	separator       string
+	normalizers     map[string][]Normalizer
+	dumpDirectItems int
+	hooks           Hooks
+	// combinations lists the declared field combinations; nil materializes every subset.
+	combinations [][]string
+	// indexes holds the Index values registered with WithIndexes.
+	indexes []any
+}
+
+// WithSnapshotReads serves Get, GetWithVersion, GetMany, Has, IDs, All, Count, Search
+// and SearchRandom from an immutable Snapshot loaded atomically, so these reads never
+// take the store's lock. With an interval of 0 every write publishes a new snapshot
+// before it returns. With a positive interval writes are published in batches at most
+// once per interval, and these reads may lag writes by up to that long; call Publish to
+// make pending writes visible immediately. Query, QueryRandom, GetBy, Compile, Explain,
+// Stats, KeyCount and the dumps always read the live index under the read lock, so they
+// can see writes that are not published yet.
+func WithSnapshotReads(interval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotReads = true
+		o.publishInterval = interval
+	}
+}
+
+// WithSeparator sets the separator between fields and values in queries passed to
+// Search and SearchRandom, e.g. "country/us/timezone/UTC+05:30" with sep "/". Picking a
+// separator that never occurs in values saves escaping ':' with Escape; a separator
+// inside a field or value can be escaped with a backslash. The default is ":".
+func WithSeparator(sep string) Option {
+	return func(o *options) {
+		o.separator = sep
+	}
+}
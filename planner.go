@@ -0,0 +1,213 @@
+package matrixsearch
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithCombinations materializes only the listed field combinations, such as
+// "country+speedtype", instead of every subset of the indexer keys. Single fields are
+// always indexed, and a combination's key lists its fields in the order given here.
+//
+// A search whose key is materialized reads its posting list directly. Any other search
+// is split into its terms and answered by intersecting materialized lists that cover
+// them, the smallest first. This trades some search speed on cold combinations for
+// memory that grows linearly rather than exponentially with the number of fields.
+func WithCombinations(combos ...string) Option {
+	return func(o *options) {
+		for _, c := range combos {
+			if fields := strings.Split(c, "+"); len(fields) > 1 {
+				o.combinations = append(o.combinations, fields)
+			}
+		}
+	}
+}
+
+// combine returns the composite keys for the normalized indexer keys of one item: every
+// subset by default, or the single keys and the declared combinations.
+func (o *options) combine(keys []string) []string {
+	if o.combinations == nil {
+		return getCombinations(keys)
+	}
+	comps := make([]string, len(keys), len(keys)+len(o.combinations))
+	byField := make(map[string][]string)
+	for i, key := range keys {
+		comps[i] = encodeKey(key)
+		field, _ := splitKey(comps[i])
+		byField[field] = append(byField[field], comps[i])
+	}
+	seen := make(map[string]bool)
+	for _, combo := range o.combinations {
+		prefixes := []string{""}
+		for _, field := range combo {
+			var next []string
+			for _, prefix := range prefixes {
+				for _, pair := range byField[field] {
+					if prefix != "" {
+						pair = prefix + ":" + pair
+					}
+					next = append(next, pair)
+				}
+			}
+			prefixes = next
+		}
+		for _, key := range prefixes {
+			if !seen[key] {
+				seen[key] = true
+				comps = append(comps, key)
+			}
+		}
+	}
+	return comps
+}
+
+// planStep is one posting list read by an intersection plan.
+type planStep struct {
+	key string
+	ids []string
+}
+
+// resolve returns the IDs matching the stored key, reading posting lists through
+// lookup and the composite keys of an item through keysOf. A materialized key is read
+// directly; with declared combinations any other key is answered by intersecting the
+// lists chosen by planIntersection.
+func (o *options) resolve(key string, lookup func(string) ([]string, bool), keysOf func(string) []string) []string {
+	if ids, ok := lookup(key); ok || o.combinations == nil {
+		return ids
+	}
+	return intersect(o.planIntersection(key, lookup), keysOf)
+}
+
+// planIntersection picks the posting lists that answer key. Candidates are the single
+// terms of key and the declared combinations made of them; the candidate with the
+// shortest list per newly covered term is taken until every term is covered. The steps
+// are returned smallest first. A step with no IDs means nothing matches.
+func (o *options) planIntersection(key string, lookup func(string) ([]string, bool)) []planStep {
+	pairs := keyPairStrings(key)
+	if len(pairs) < 2 || len(keyParts(key))%2 != 0 {
+		return nil
+	}
+	type candidate struct {
+		planStep
+		covers []int
+	}
+	termOf := make(map[string]int, len(pairs))
+	candidates := make([]candidate, 0, len(pairs)+len(o.combinations))
+	for i, pair := range pairs {
+		field, _ := splitKey(pair)
+		if _, dup := termOf[field]; dup {
+			// A field given twice cannot be matched to a combination.
+			termOf[field] = -1
+		} else {
+			termOf[field] = i
+		}
+		ids, _ := lookup(pair)
+		candidates = append(candidates, candidate{planStep{pair, ids}, []int{i}})
+	}
+next:
+	for _, combo := range o.combinations {
+		c := candidate{}
+		keys := make([]string, len(combo))
+		for j, field := range combo {
+			i, ok := termOf[field]
+			if !ok || i < 0 {
+				continue next
+			}
+			keys[j] = pairs[i]
+			c.covers = append(c.covers, i)
+		}
+		c.key = strings.Join(keys, ":")
+		c.ids, _ = lookup(c.key)
+		candidates = append(candidates, c)
+	}
+
+	covered := make([]bool, len(pairs))
+	left := len(pairs)
+	var steps []planStep
+	for left > 0 {
+		// The cost of a candidate is its list length per term it newly covers.
+		best, bestNew := -1, 0
+		for i, c := range candidates {
+			n := 0
+			for _, t := range c.covers {
+				if !covered[t] {
+					n++
+				}
+			}
+			if n > 0 && (best < 0 || len(c.ids)*bestNew < len(candidates[best].ids)*n) {
+				best, bestNew = i, n
+			}
+		}
+		steps = append(steps, candidates[best].planStep)
+		if len(candidates[best].ids) == 0 {
+			return steps
+		}
+		for _, t := range candidates[best].covers {
+			if !covered[t] {
+				covered[t] = true
+				left--
+			}
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return len(steps[i].ids) < len(steps[j].ids) })
+	return steps
+}
+
+// intersect returns the IDs present in every step, in the order of the first. Rather
+// than reading the other lists, it checks the single keys of each ID of the first step,
+// read through keysOf, against the pairs of the other steps' keys.
+func intersect(steps []planStep, keysOf func(string) []string) []string {
+	if len(steps) == 0 {
+		return nil
+	}
+	for _, s := range steps {
+		if len(s.ids) == 0 {
+			return nil
+		}
+	}
+	if len(steps) == 1 {
+		return steps[0].ids
+	}
+	var pairs []string
+	for _, s := range steps[1:] {
+		pairs = append(pairs, keyPairStrings(s.key)...)
+	}
+	var ids []string
+next:
+	for _, id := range steps[0].ids {
+		held := baseKeys(keysOf(id))
+		for _, p := range pairs {
+			if !holds(held, p) {
+				continue next
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// holds reports whether keys contains key.
+func holds(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// indexedLocked reads the posting list of a materialized key.
+func (ds *DataStore[T]) indexedLocked(key string) ([]string, bool) {
+	ids, ok := ds.compositeIndex[key]
+	return ids, ok
+}
+
+// lookupLocked returns the IDs matching the stored key.
+func (ds *DataStore[T]) lookupLocked(key string) []string {
+	return ds.opts.resolve(key, ds.indexedLocked, ds.keysLocked)
+}
+
+// keysLocked returns the composite keys of the item stored under id.
+func (ds *DataStore[T]) keysLocked(id string) []string {
+	return ds.itemKeys[id]
+}
@@ -0,0 +1,183 @@
+package matrixsearch
+
+import "sync/atomic"
+
+const (
+	// pmapBits is the number of hash bits that select a child at each level of a pmap.
+	pmapBits  = 5
+	pmapWidth = 1 << pmapBits
+	pmapMask  = pmapWidth - 1
+	// pmapLeaf is the most entries a leaf holds before it is split into a branch, unless
+	// the hash is used up.
+	pmapLeaf = 8
+)
+
+// pmapEdits hands out the edit tokens of pmap updates.
+var pmapEdits atomic.Uint64
+
+// newEdit returns a token for a batch of pmap updates. Nodes created under the token may
+// be changed in place by later updates carrying the same token, so a batch copies each
+// node at most once. A token must not be used again once the map has been shared.
+func newEdit() uint64 {
+	return pmapEdits.Add(1)
+}
+
+// pmap is a persistent hash trie from strings to V. An update copies only the nodes on
+// the path to the changed key, so earlier versions of the map stay valid and share
+// everything else with it. The zero value is an empty map.
+type pmap[V any] struct {
+	root *pnode[V]
+	len  int
+}
+
+// pnode is a branch when children is set and a leaf otherwise.
+type pnode[V any] struct {
+	edit     uint64
+	children []*pnode[V]
+	entries  []pentry[V]
+}
+
+type pentry[V any] struct {
+	hash  uint64
+	key   string
+	value V
+}
+
+func hashKey(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (m *pmap[V]) get(key string) (V, bool) {
+	h := hashKey(key)
+	n := m.root
+	for shift := uint(0); n != nil && n.children != nil; shift += pmapBits {
+		n = n.children[(h>>shift)&pmapMask]
+	}
+	if n != nil {
+		for _, e := range n.entries {
+			if e.hash == h && e.key == key {
+				return e.value, true
+			}
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (m *pmap[V]) set(edit uint64, key string, v V) {
+	var added bool
+	m.root = m.root.set(edit, hashKey(key), 0, key, v, &added)
+	if added {
+		m.len++
+	}
+}
+
+func (m *pmap[V]) delete(edit uint64, key string) {
+	var removed bool
+	m.root = m.root.delete(edit, hashKey(key), 0, key, &removed)
+	if removed {
+		m.len--
+	}
+}
+
+// each calls fn for every entry, in no particular order.
+func (m *pmap[V]) each(fn func(key string, v V)) {
+	m.root.each(fn)
+}
+
+// own returns n if edit created it, and a copy of n owned by edit otherwise.
+func (n *pnode[V]) own(edit uint64) *pnode[V] {
+	if n.edit == edit {
+		return n
+	}
+	c := &pnode[V]{edit: edit}
+	if n.children != nil {
+		c.children = append([]*pnode[V](nil), n.children...)
+	} else {
+		c.entries = append(make([]pentry[V], 0, len(n.entries)+1), n.entries...)
+	}
+	return c
+}
+
+func (n *pnode[V]) set(edit, h uint64, shift uint, key string, v V, added *bool) *pnode[V] {
+	if n == nil {
+		*added = true
+		return &pnode[V]{edit: edit, entries: []pentry[V]{{h, key, v}}}
+	}
+	n = n.own(edit)
+	if n.children != nil {
+		i := (h >> shift) & pmapMask
+		n.children[i] = n.children[i].set(edit, h, shift+pmapBits, key, v, added)
+		return n
+	}
+	for i := range n.entries {
+		if n.entries[i].hash == h && n.entries[i].key == key {
+			n.entries[i].value = v
+			return n
+		}
+	}
+	*added = true
+	n.entries = append(n.entries, pentry[V]{h, key, v})
+	if len(n.entries) > pmapLeaf && shift+pmapBits < 64 {
+		n.children = make([]*pnode[V], pmapWidth)
+		for _, e := range n.entries {
+			i := (e.hash >> shift) & pmapMask
+			if n.children[i] == nil {
+				n.children[i] = &pnode[V]{edit: edit}
+			}
+			n.children[i].entries = append(n.children[i].entries, e)
+		}
+		n.entries = nil
+	}
+	return n
+}
+
+func (n *pnode[V]) delete(edit, h uint64, shift uint, key string, removed *bool) *pnode[V] {
+	if n == nil {
+		return nil
+	}
+	if n.children != nil {
+		i := (h >> shift) & pmapMask
+		c := n.children[i].delete(edit, h, shift+pmapBits, key, removed)
+		if !*removed {
+			return n
+		}
+		n = n.own(edit)
+		n.children[i] = c
+		for _, c := range n.children {
+			if c != nil {
+				return n
+			}
+		}
+		return nil
+	}
+	for i, e := range n.entries {
+		if e.hash == h && e.key == key {
+			*removed = true
+			if len(n.entries) == 1 {
+				return nil
+			}
+			n = n.own(edit)
+			n.entries = append(n.entries[:i], n.entries[i+1:]...)
+			return n
+		}
+	}
+	return n
+}
+
+func (n *pnode[V]) each(fn func(key string, v V)) {
+	if n == nil {
+		return
+	}
+	for _, c := range n.children {
+		c.each(fn)
+	}
+	for _, e := range n.entries {
+		fn(e.key, e.value)
+	}
+}
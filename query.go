@@ -0,0 +1,493 @@
+package matrixsearch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownField is returned when a Query refers to a field that no indexed item has
+// ever produced a key for.
+var ErrUnknownField = errors.New("matrixsearch: unknown field")
+
+// Query describes a search by field and value. Build one with Q and run it with
+// DataStore.Query; terms are put in the order the store's indexer emits them, so the
+// order of the calls does not matter.
+type Query struct {
+	terms []queryTerm
+}
+
+// queryTerm matches one field against a set of alternative values, against a numeric
+// range when ranged is set, or against the words of its value when text is set.
+type queryTerm struct {
+	field  string
+	values []string
+	ranged bool
+	text   bool
+	lo, hi float64
+	loInc  bool
+	hiInc  bool
+}
+
+// Q starts an empty query.
+func Q() *Query {
+	return &Query{}
+}
+
+// Eq requires field to equal value. Repeating Eq for the same field requires every
+// value, which only matches multi-valued fields such as tagged slices.
+func (q *Query) Eq(field string, value any) *Query {
+	q.terms = append(q.terms, queryTerm{field: field, values: []string{formatAny(value)}})
+	return q
+}
+
+// In requires field to equal one of values.
+func (q *Query) In(field string, values ...any) *Query {
+	t := queryTerm{field: field, values: make([]string, len(values))}
+	for i, v := range values {
+		t.values[i] = formatAny(v)
+	}
+	q.terms = append(q.terms, t)
+	return q
+}
+
+// Match requires the text index field to hold every word of text, in any order and
+// case. Match on a field without a text index is an error.
+func (q *Query) Match(field, text string) *Query {
+	q.terms = append(q.terms, queryTerm{field: field, values: []string{text}, text: true})
+	return q
+}
+
+// Gt requires the numeric value of field to be greater than v.
+func (q *Query) Gt(field string, v float64) *Query {
+	q.rangeTerm(field).setLo(v, false)
+	return q
+}
+
+// Gte requires the numeric value of field to be greater than or equal to v.
+func (q *Query) Gte(field string, v float64) *Query {
+	q.rangeTerm(field).setLo(v, true)
+	return q
+}
+
+// Lt requires the numeric value of field to be less than v.
+func (q *Query) Lt(field string, v float64) *Query {
+	q.rangeTerm(field).setHi(v, false)
+	return q
+}
+
+// Lte requires the numeric value of field to be less than or equal to v.
+func (q *Query) Lte(field string, v float64) *Query {
+	q.rangeTerm(field).setHi(v, true)
+	return q
+}
+
+// After requires the time in field to be later than t. Times are indexed with second
+// precision.
+func (q *Query) After(field string, t time.Time) *Query {
+	return q.Gt(field, float64(t.Unix()))
+}
+
+// Before requires the time in field to be earlier than t.
+func (q *Query) Before(field string, t time.Time) *Query {
+	return q.Lt(field, float64(t.Unix()))
+}
+
+// Since requires the time in field to be within the last d, e.g. Since("lastseen",
+// 5*time.Minute) for items seen in the last five minutes.
+func (q *Query) Since(field string, d time.Duration) *Query {
+	return q.Gte(field, float64(time.Now().Add(-d).Unix()))
+}
+
+// rangeTerm returns the range term for field, adding one if needed, so that bounds on
+// the same field combine into a single interval.
+func (q *Query) rangeTerm(field string) *queryTerm {
+	for i := range q.terms {
+		if q.terms[i].ranged && q.terms[i].field == field {
+			return &q.terms[i]
+		}
+	}
+	q.terms = append(q.terms, queryTerm{field: field, ranged: true, lo: math.Inf(-1), hi: math.Inf(1), loInc: true, hiInc: true})
+	return &q.terms[len(q.terms)-1]
+}
+
+func (t *queryTerm) setLo(v float64, inclusive bool) {
+	if v > t.lo || (v == t.lo && !inclusive) {
+		t.lo, t.loInc = v, inclusive
+	}
+}
+
+func (t *queryTerm) setHi(v float64, inclusive bool) {
+	if v < t.hi || (v == t.hi && !inclusive) {
+		t.hi, t.hiInc = v, inclusive
+	}
+}
+
+func (t *queryTerm) contains(v float64) bool {
+	return (v > t.lo || (t.loInc && v == t.lo)) && (v < t.hi || (t.hiInc && v == t.hi))
+}
+
+// formatAny renders v the way AutoIndexer renders field values.
+func formatAny(v any) string {
+	rv := indirect(reflect.ValueOf(v))
+	if !rv.IsValid() {
+		return ""
+	}
+	if format := formatterFor(rv.Type()); format != nil {
+		return format(rv)
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+// String renders q for logs and hooks, e.g. country=us speed>=10.
+func (q *Query) String() string {
+	var b strings.Builder
+	for i, t := range q.terms {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.field)
+		switch {
+		case t.ranged:
+			var bounds []string
+			if !math.IsInf(t.lo, -1) {
+				op := ">"
+				if t.loInc {
+					op = ">="
+				}
+				bounds = append(bounds, op+formatNumber(t.lo))
+			}
+			if !math.IsInf(t.hi, 1) {
+				op := "<"
+				if t.hiInc {
+					op = "<="
+				}
+				bounds = append(bounds, op+formatNumber(t.hi))
+			}
+			b.WriteString(strings.Join(bounds, ","))
+		case t.text:
+			b.WriteString("~" + t.values[0])
+		case len(t.values) == 1:
+			b.WriteString("=" + t.values[0])
+		default:
+			b.WriteString(" in (" + strings.Join(t.values, ",") + ")")
+		}
+	}
+	return b.String()
+}
+
+// Compile returns the search keys q expands to, for passing to Search: one key per
+// combination of the terms' values, with the fields in the order the indexer first
+// emitted them. Terms on indexes registered with WithIndexes are left out. Query does not
+// use these keys; it intersects the terms one by one, so it also finds items whose
+// indexer emits the fields in another order or skips some of them.
+func (ds *DataStore[T]) Compile(q *Query) ([]string, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	keys, err := ds.compileLocked(q)
+	return keys, ds.opts.reportError("compile", err)
+}
+
+// Query returns the items matching q, without duplicates.
+func (ds *DataStore[T]) Query(q *Query) ([]T, error) {
+	if ds.opts.hooks == nil {
+		return ds.query(q)
+	}
+	start := time.Now()
+	results, err := ds.query(q)
+	ds.opts.hooks.OnSearch(q.String(), len(results), time.Since(start))
+	return results, ds.opts.reportError("query", err)
+}
+
+func (ds *DataStore[T]) query(q *Query) ([]T, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	ids, err := ds.queryIDsLocked(q)
+	if err != nil {
+		return nil, err
+	}
+	var results []T
+	for _, id := range ids {
+		results = append(results, ds.items[id])
+	}
+	return results, nil
+}
+
+// QueryRandom returns a random item matching q. Every matching item is equally likely.
+func (ds *DataStore[T]) QueryRandom(q *Query) (T, bool, error) {
+	if ds.opts.hooks == nil {
+		return ds.queryRandom(q)
+	}
+	start := time.Now()
+	item, ok, err := ds.queryRandom(q)
+	ds.opts.hooks.OnSearch(q.String(), hitCount(ok), time.Since(start))
+	return item, ok, ds.opts.reportError("query", err)
+}
+
+func (ds *DataStore[T]) queryRandom(q *Query) (T, bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var zero T
+	ids, err := ds.queryIDsLocked(q)
+	if err != nil || len(ids) == 0 {
+		return zero, false, err
+	}
+	return ds.items[ids[rand.Intn(len(ids))]], true, nil
+}
+
+// queryCount returns the number of items matching q.
+func (ds *DataStore[T]) queryCount(q *Query) (int, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	ids, err := ds.queryIDsLocked(q)
+	return len(ids), err
+}
+
+// queryStep is one term of a query resolved against an index: an upper bound on the
+// number of IDs it matches, how to list them and how to test a single ID.
+type queryStep struct {
+	size  int
+	ids   func() []string
+	match func(id string) bool
+}
+
+// queryIDsLocked returns the IDs matching q. Every term is resolved on its own, against
+// the single-field keys of the composite index or against a registered index. The IDs
+// of the smallest term are listed and tested against the other terms, so the result
+// does not depend on the order in which items emit their fields.
+func (ds *DataStore[T]) queryIDsLocked(q *Query) ([]string, error) {
+	if len(q.terms) == 0 {
+		return nil, nil
+	}
+	steps := make([]queryStep, len(q.terms))
+	for i := range q.terms {
+		t := &q.terms[i]
+		var err error
+		if s, ok := ds.indexes[t.field]; ok {
+			steps[i], err = s.step(t, ds.items)
+		} else {
+			steps[i], err = ds.termStepLocked(t)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return intersectSteps(steps), nil
+}
+
+// intersectSteps returns the IDs of the smallest step that every other step matches.
+func intersectSteps(steps []queryStep) []string {
+	smallest := 0
+	for i, s := range steps {
+		if s.size < steps[smallest].size {
+			smallest = i
+		}
+	}
+	if steps[smallest].size == 0 {
+		return nil
+	}
+	ids := steps[smallest].ids()
+	if len(steps) == 1 {
+		return ids
+	}
+	var out []string
+next:
+	for _, id := range ids {
+		for i, s := range steps {
+			if i != smallest && !s.match(id) {
+				continue next
+			}
+		}
+		out = append(out, id)
+	}
+	return out
+}
+
+// termStepLocked resolves t against the single-field keys of the composite index, which
+// are materialized whatever combinations are declared.
+func (ds *DataStore[T]) termStepLocked(t *queryTerm) (queryStep, error) {
+	if t.text {
+		return queryStep{}, fmt.Errorf("matrixsearch: Match on %q, which has no text index", t.field)
+	}
+	if _, ok := ds.fieldRank[t.field]; !ok {
+		return queryStep{}, fmt.Errorf("%w %q", ErrUnknownField, t.field)
+	}
+	values := ds.termValuesLocked(t)
+	prefix := Escape(t.field) + ":"
+	keys := make([]string, len(values))
+	size := 0
+	for i, v := range values {
+		keys[i] = prefix + Escape(v)
+		size += len(ds.compositeIndex[keys[i]])
+	}
+	accepts := func(v string) bool {
+		for _, value := range values {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	}
+	if t.ranged {
+		accepts = func(v string) bool {
+			f, err := strconv.ParseFloat(v, 64)
+			return err == nil && t.contains(f)
+		}
+	}
+	return queryStep{
+		size: size,
+		ids: func() []string {
+			if len(keys) == 1 {
+				return ds.compositeIndex[keys[0]]
+			}
+			var ids []string
+			for _, key := range keys {
+				ids = append(ids, ds.compositeIndex[key]...)
+			}
+			return dedupe(ids)
+		},
+		match: func(id string) bool {
+			for _, key := range baseKeys(ds.itemKeys[id]) {
+				if strings.HasPrefix(key, prefix) && accepts(unescape(key[len(prefix):])) {
+					return true
+				}
+			}
+			return false
+		},
+	}, nil
+}
+
+// termValuesLocked returns the stored values t accepts: the known values in its range,
+// or its values after the field's normalizers.
+func (ds *DataStore[T]) termValuesLocked(t *queryTerm) []string {
+	if t.ranged {
+		return ds.valuesInRangeLocked(t)
+	}
+	fns := ds.opts.fieldNormalizers(t.field)
+	if fns == nil {
+		return t.values
+	}
+	values := make([]string, len(t.values))
+	for i, v := range t.values {
+		values[i] = normalize(fns, v)
+	}
+	return values
+}
+
+func (ds *DataStore[T]) compileLocked(q *Query) ([]string, error) {
+	type alternatives struct {
+		field  string
+		rank   int
+		values []string
+	}
+	var terms []alternatives
+	for i := range q.terms {
+		t := &q.terms[i]
+		if _, ok := ds.indexes[t.field]; ok {
+			continue
+		}
+		if t.text {
+			return nil, fmt.Errorf("matrixsearch: Match on %q, which has no text index", t.field)
+		}
+		rank, ok := ds.fieldRank[t.field]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownField, t.field)
+		}
+		values := ds.termValuesLocked(t)
+		if len(values) == 0 {
+			return nil, nil
+		}
+		terms = append(terms, alternatives{field: t.field, rank: rank, values: values})
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(terms, func(i, j int) bool { return terms[i].rank < terms[j].rank })
+	keys := []string{""}
+	for _, t := range terms {
+		next := make([]string, 0, len(keys)*len(t.values))
+		for _, prefix := range keys {
+			for _, v := range t.values {
+				key := Escape(t.field) + ":" + Escape(v)
+				if prefix != "" {
+					key = prefix + ":" + key
+				}
+				next = append(next, key)
+			}
+		}
+		keys = next
+	}
+	return keys, nil
+}
+
+// valuesInRangeLocked returns the known values of t's field that parse as numbers
+// inside t's range, in ascending order. The bounds are found by binary search.
+func (ds *DataStore[T]) valuesInRangeLocked(t *queryTerm) []string {
+	numbers := ds.fieldNumbers[t.field]
+	if numbers == nil {
+		return nil
+	}
+	return numbers.between(t)
+}
+
+// countFieldsLocked adds delta to the value counts of the single-field keys in comps.
+// Fields are ranked the first time they are seen and keep their rank afterwards.
+func (ds *DataStore[T]) countFieldsLocked(comps []string, delta int) {
+	for _, key := range baseKeys(comps) {
+		field, value := splitKey(key)
+		if _, ok := ds.fieldRank[field]; !ok {
+			ds.fieldRank[field] = len(ds.fieldRank)
+		}
+		ds.countValueLocked(field, value, delta)
+	}
+}
+
+// countValueLocked adds delta to the count of value in field, adding the value to the
+// field's numbers when it first appears and removing it when its count drops to zero.
+func (ds *DataStore[T]) countValueLocked(field, value string, delta int) {
+	values := ds.fieldValues[field]
+	if values == nil {
+		values = make(map[string]int)
+		ds.fieldValues[field] = values
+	}
+	n := values[value]
+	values[value] += delta
+	added, removed := n <= 0 && values[value] > 0, n > 0 && values[value] <= 0
+	if values[value] <= 0 {
+		delete(values, value)
+	}
+	if !added && !removed {
+		return
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f != f {
+		return
+	}
+	// Numbers are kept as range entries whose ID is the value as stored.
+	numbers := ds.fieldNumbers[field]
+	if numbers == nil {
+		numbers = &rangeList{}
+		ds.fieldNumbers[field] = numbers
+	}
+	if added {
+		numbers.insert(rangeEntry{f, value})
+	} else {
+		numbers.remove(rangeEntry{f, value})
+	}
+}
+
+// baseKeys returns the indexer keys that comps was built from. Both getCombinations and
+// declared combinations put them first.
+func baseKeys(comps []string) []string {
+	n := 0
+	for n < len(comps) && keyPairs(comps[n]) == 1 {
+		n++
+	}
+	return comps[:n]
+}
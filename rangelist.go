@@ -0,0 +1,119 @@
+package matrixsearch
+
+import "sort"
+
+// rangeChunk is the most entries a chunk of a rangeList holds before it is split.
+const rangeChunk = 512
+
+// rangeList holds range entries in ascending order. The entries are kept in sorted
+// chunks of at most rangeChunk entries, so an insert or a removal only shifts one chunk
+// rather than every entry after it.
+type rangeList struct {
+	chunks [][]rangeEntry
+}
+
+// chunkOf returns the chunk that holds e or would receive it.
+func (l *rangeList) chunkOf(e rangeEntry) int {
+	c := sort.Search(len(l.chunks), func(c int) bool {
+		chunk := l.chunks[c]
+		return !chunk[len(chunk)-1].less(e)
+	})
+	if c == len(l.chunks) {
+		c--
+	}
+	return c
+}
+
+func (l *rangeList) insert(e rangeEntry) {
+	if len(l.chunks) == 0 {
+		l.chunks = [][]rangeEntry{{e}}
+		return
+	}
+	c := l.chunkOf(e)
+	chunk := l.chunks[c]
+	i := sort.Search(len(chunk), func(i int) bool { return !chunk[i].less(e) })
+	chunk = append(chunk, rangeEntry{})
+	copy(chunk[i+1:], chunk[i:])
+	chunk[i] = e
+	if len(chunk) <= rangeChunk {
+		l.chunks[c] = chunk
+		return
+	}
+	// The upper half gets its own array, so appending to the lower half cannot reach it.
+	half := len(chunk) / 2
+	upper := append([]rangeEntry(nil), chunk[half:]...)
+	l.chunks[c] = chunk[:half]
+	l.chunks = append(l.chunks, nil)
+	copy(l.chunks[c+2:], l.chunks[c+1:])
+	l.chunks[c+1] = upper
+}
+
+func (l *rangeList) remove(e rangeEntry) {
+	if len(l.chunks) == 0 {
+		return
+	}
+	c := l.chunkOf(e)
+	chunk := l.chunks[c]
+	i := sort.Search(len(chunk), func(i int) bool { return !chunk[i].less(e) })
+	if i == len(chunk) || chunk[i] != e {
+		return
+	}
+	if len(chunk) == 1 {
+		l.chunks = append(l.chunks[:c], l.chunks[c+1:]...)
+		return
+	}
+	l.chunks[c] = append(chunk[:i], chunk[i+1:]...)
+}
+
+// search returns the chunk and offset of the first entry whose value satisfies above,
+// which must be false for lower values and true for higher ones.
+func (l *rangeList) search(above func(v float64) bool) (int, int) {
+	c := sort.Search(len(l.chunks), func(c int) bool {
+		chunk := l.chunks[c]
+		return above(chunk[len(chunk)-1].value)
+	})
+	if c == len(l.chunks) {
+		return c, 0
+	}
+	chunk := l.chunks[c]
+	return c, sort.Search(len(chunk), func(i int) bool { return above(chunk[i].value) })
+}
+
+// count returns the number of entries whose value lies in t's range.
+func (l *rangeList) count(t *queryTerm) int {
+	c1, i1 := l.search(aboveLo(t))
+	c2, i2 := l.search(aboveHi(t))
+	if c2 < c1 || (c2 == c1 && i2 <= i1) {
+		return 0
+	}
+	n := i2 - i1
+	for c := c1; c < c2; c++ {
+		n += len(l.chunks[c])
+	}
+	return n
+}
+
+// between returns the IDs whose value lies in t's range, in ascending order of value.
+func (l *rangeList) between(t *queryTerm) []string {
+	var ids []string
+	c, i := l.search(aboveLo(t))
+	for ; c < len(l.chunks); c, i = c+1, 0 {
+		for _, e := range l.chunks[c][i:] {
+			if !t.contains(e.value) {
+				return ids
+			}
+			ids = append(ids, e.id)
+		}
+	}
+	return ids
+}
+
+// aboveLo and aboveHi return the predicates for search that find the first entry in
+// t's range and the first entry above it.
+func aboveLo(t *queryTerm) func(v float64) bool {
+	return func(v float64) bool { return v > t.lo || (t.loInc && v == t.lo) }
+}
+
+func aboveHi(t *queryTerm) func(v float64) bool {
+	return func(v float64) bool { return v > t.hi || (!t.hiInc && v == t.hi) }
+}
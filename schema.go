@@ -0,0 +1,488 @@
+package matrixsearch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// indexKind is how a secondary index stores and matches its values.
+type indexKind int
+
+const (
+	hashIndex indexKind = iota
+	rangeIndex
+	textIndex
+	uniqueIndex
+)
+
+func (k indexKind) String() string {
+	switch k {
+	case rangeIndex:
+		return "range"
+	case textIndex:
+		return "text"
+	case uniqueIndex:
+		return "unique"
+	}
+	return "hash"
+}
+
+// ErrDuplicate is returned when an insert would give an item a unique value held by
+// another item, on an index that rejects duplicates.
+var ErrDuplicate = errors.New("matrixsearch: duplicate unique value")
+
+// Conflict is what a unique index does when an item is inserted with a value held by
+// another item.
+type Conflict int
+
+const (
+	// ConflictReplace deletes the item holding the value. It is the default.
+	ConflictReplace Conflict = iota
+	// ConflictReject leaves the store unchanged and fails the insert with ErrDuplicate.
+	ConflictReject
+)
+
+// Index declares a named secondary index with its own extractor. Build one with
+// HashIndex, RangeIndex, TextIndex or UniqueIndex and register it with WithIndexes.
+type Index[T any] struct {
+	name     string
+	kind     indexKind
+	values   func(T) []string
+	number   func(T) float64
+	conflict Conflict
+}
+
+// HashIndex indexes the values returned by values for equality, like a field of the
+// composite index but without taking part in its combinations. Query terms on name
+// made with Eq and In are answered from it.
+func HashIndex[T any](name string, values func(T) []string) Index[T] {
+	return Index[T]{name: name, kind: hashIndex, values: values}
+}
+
+// RangeIndex keeps the items sorted by value, so that Gt, Gte, Lt and Lte terms on name
+// are answered by binary search rather than by scanning the known values.
+func RangeIndex[T any](name string, value func(T) float64) Index[T] {
+	return Index[T]{name: name, kind: rangeIndex, number: value}
+}
+
+// TextIndex indexes the words of the text returned by text, lower-cased. Match terms on
+// name find the items holding every word of the search text.
+func TextIndex[T any](name string, text func(T) string) Index[T] {
+	return Index[T]{name: name, kind: textIndex, values: func(item T) []string { return tokenize(text(item)) }}
+}
+
+// UniqueIndex maps each value returned by value to the single item holding it, which
+// GetBy looks up. An empty value is not indexed. Inserting an item whose value is held
+// by another item replaces that item, unless OnConflict says otherwise.
+func UniqueIndex[T any](name string, value func(T) string) Index[T] {
+	return Index[T]{name: name, kind: uniqueIndex, values: func(item T) []string {
+		if v := value(item); v != "" {
+			return []string{v}
+		}
+		return nil
+	}}
+}
+
+// OnConflict sets what a unique index does with an item whose value is held by another
+// item. It has no effect on other indexes.
+func (idx Index[T]) OnConflict(c Conflict) Index[T] {
+	idx.conflict = c
+	return idx
+}
+
+// WithIndexes registers secondary indexes next to the composite index built from the
+// indexer, which may then be nil. Query terms on an index's name are routed to it and
+// intersected with the terms answered by the composite index. Normalizers registered
+// for the name apply to hash and unique values.
+//
+// NewDataStore panics if two indexes share a name or the indexes are for another item
+// type. A ShardedDataStore keeps one set of indexes per shard and refuses unique
+// indexes.
+func WithIndexes[T any](indexes ...Index[T]) Option {
+	return func(o *options) {
+		for _, idx := range indexes {
+			o.indexes = append(o.indexes, idx)
+		}
+	}
+}
+
+// schemaIndex is a registered Index and its contents.
+type schemaIndex[T any] struct {
+	Index[T]
+	norm []Normalizer
+	// postings maps hash values and text words to the IDs holding them.
+	postings map[string][]string
+	// owners maps unique values to the ID holding them.
+	owners map[string]string
+	// sorted holds range values in ascending order, ties broken by ID.
+	sorted rangeList
+}
+
+type rangeEntry struct {
+	value float64
+	id    string
+}
+
+func (e rangeEntry) less(o rangeEntry) bool {
+	return e.value < o.value || (e.value == o.value && e.id < o.id)
+}
+
+// buildIndexes sets up the indexes registered with WithIndexes.
+func (ds *DataStore[T]) buildIndexes() {
+	for _, x := range ds.opts.indexes {
+		idx, ok := x.(Index[T])
+		if !ok {
+			panic(fmt.Sprintf("matrixsearch: %T registered on a store of %T", x, *new(T)))
+		}
+		if _, dup := ds.indexes[idx.name]; dup {
+			panic(fmt.Sprintf("matrixsearch: index %q registered twice", idx.name))
+		}
+		if ds.indexes == nil {
+			ds.indexes = make(map[string]*schemaIndex[T])
+		}
+		s := &schemaIndex[T]{Index: idx}
+		if idx.kind != textIndex {
+			s.norm = ds.opts.fieldNormalizers(idx.name)
+		}
+		s.reset()
+		ds.indexes[idx.name] = s
+		ds.indexOrder = append(ds.indexOrder, s)
+	}
+}
+
+func (s *schemaIndex[T]) reset() {
+	s.postings, s.owners, s.sorted = nil, nil, rangeList{}
+	switch s.kind {
+	case hashIndex, textIndex:
+		s.postings = make(map[string][]string)
+	case uniqueIndex:
+		s.owners = make(map[string]string)
+	}
+}
+
+// extract returns the normalized values of item, without duplicates.
+func (s *schemaIndex[T]) extract(item T) []string {
+	values := s.values(item)
+	if s.norm == nil && len(values) < 2 {
+		return values
+	}
+	seen := make(map[string]bool, len(values))
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		v = normalize(s.norm, v)
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (s *schemaIndex[T]) add(id string, item T) {
+	switch s.kind {
+	case rangeIndex:
+		e := rangeEntry{s.number(item), id}
+		if e.value != e.value {
+			// NaN has no place in the order and never matches a range.
+			return
+		}
+		s.sorted.insert(e)
+	case uniqueIndex:
+		for _, v := range s.extract(item) {
+			s.owners[v] = id
+		}
+	default:
+		for _, v := range s.extract(item) {
+			s.postings[v] = append(s.postings[v], id)
+		}
+	}
+}
+
+func (s *schemaIndex[T]) remove(id string, item T) {
+	switch s.kind {
+	case rangeIndex:
+		s.sorted.remove(rangeEntry{s.number(item), id})
+	case uniqueIndex:
+		for _, v := range s.extract(item) {
+			if s.owners[v] == id {
+				delete(s.owners, v)
+			}
+		}
+	default:
+		for _, v := range s.extract(item) {
+			newIDs := []string{}
+			for _, itemID := range s.postings[v] {
+				if itemID != id {
+					newIDs = append(newIDs, itemID)
+				}
+			}
+			if len(newIDs) == 0 {
+				delete(s.postings, v)
+			} else {
+				s.postings[v] = newIDs
+			}
+		}
+	}
+}
+
+// step resolves t, which must be on s, for Query. The match function of the step reads
+// the item from items and tests its own values, so no set of IDs is built.
+func (s *schemaIndex[T]) step(t *queryTerm, items map[string]T) (queryStep, error) {
+	if t.text && s.kind != textIndex {
+		return queryStep{}, fmt.Errorf("matrixsearch: Match on %s index %q", s.kind, s.name)
+	}
+	if t.ranged && s.kind != rangeIndex {
+		return queryStep{}, fmt.Errorf("matrixsearch: range on %s index %q", s.kind, s.name)
+	}
+	switch s.kind {
+	case rangeIndex:
+		ranges := []*queryTerm{t}
+		if !t.ranged {
+			ranges = ranges[:0]
+			for _, v := range t.values {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return queryStep{}, fmt.Errorf("matrixsearch: %q is not a number for range index %q", v, s.name)
+				}
+				ranges = append(ranges, &queryTerm{lo: f, hi: f, loInc: true, hiInc: true})
+			}
+		}
+		size := 0
+		for _, r := range ranges {
+			size += s.sorted.count(r)
+		}
+		return queryStep{
+			size: size,
+			ids: func() []string {
+				var ids []string
+				for _, r := range ranges {
+					ids = append(ids, s.sorted.between(r)...)
+				}
+				if len(ranges) > 1 {
+					ids = dedupe(ids)
+				}
+				return ids
+			},
+			match: func(id string) bool {
+				f := s.number(items[id])
+				for _, r := range ranges {
+					if r.contains(f) {
+						return true
+					}
+				}
+				return false
+			},
+		}, nil
+	case textIndex:
+		alternatives := make([][]string, len(t.values))
+		size := 0
+		for i, v := range t.values {
+			alternatives[i] = tokenize(v)
+			size += s.rarest(alternatives[i])
+		}
+		return queryStep{
+			size: size,
+			ids: func() []string {
+				var ids []string
+				for _, words := range alternatives {
+					ids = append(ids, s.words(words, items)...)
+				}
+				if len(alternatives) > 1 {
+					ids = dedupe(ids)
+				}
+				return ids
+			},
+			match: func(id string) bool {
+				tokens := s.values(items[id])
+				for _, words := range alternatives {
+					if holdsAll(tokens, words) {
+						return true
+					}
+				}
+				return false
+			},
+		}, nil
+	}
+	values := make([]string, len(t.values))
+	size := 0
+	for i, v := range t.values {
+		values[i] = normalize(s.norm, v)
+		if s.kind == uniqueIndex {
+			if _, ok := s.owners[values[i]]; ok {
+				size++
+			}
+		} else {
+			size += len(s.postings[values[i]])
+		}
+	}
+	return queryStep{
+		size: size,
+		ids: func() []string {
+			var ids []string
+			for _, v := range values {
+				if s.kind == uniqueIndex {
+					if id, ok := s.owners[v]; ok {
+						ids = append(ids, id)
+					}
+				} else {
+					ids = append(ids, s.postings[v]...)
+				}
+			}
+			if len(values) > 1 {
+				ids = dedupe(ids)
+			}
+			return ids
+		},
+		match: func(id string) bool {
+			for _, v := range s.extract(items[id]) {
+				for _, want := range values {
+					if v == want {
+						return true
+					}
+				}
+			}
+			return false
+		},
+	}, nil
+}
+
+// rarest returns the length of the shortest posting list of words, or 0 without words.
+func (s *schemaIndex[T]) rarest(words []string) int {
+	n := 0
+	for i, w := range words {
+		if l := len(s.postings[w]); i == 0 || l < n {
+			n = l
+		}
+	}
+	return n
+}
+
+// words returns the IDs holding every word. The shortest posting list is read and each
+// of its items is checked for the other words.
+func (s *schemaIndex[T]) words(words []string, items map[string]T) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	rarest := words[0]
+	for _, w := range words[1:] {
+		if len(s.postings[w]) < len(s.postings[rarest]) {
+			rarest = w
+		}
+	}
+	if len(words) == 1 {
+		return s.postings[rarest]
+	}
+	var ids []string
+	for _, id := range s.postings[rarest] {
+		if holdsAll(s.values(items[id]), words) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// holdsAll reports whether tokens contains every word. An empty list of words holds
+// nothing.
+func holdsAll(tokens, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+next:
+	for _, w := range words {
+		for _, tok := range tokens {
+			if tok == w {
+				continue next
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// tokenize splits text into lower-cased words of letters and digits, without duplicates.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return dedupe(fields)
+}
+
+// dedupe removes repeated strings from ids, keeping the first of each.
+func dedupe(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// indexSchemaLocked adds item to every registered index.
+func (ds *DataStore[T]) indexSchemaLocked(id string, item T) {
+	for _, s := range ds.indexOrder {
+		s.add(id, item)
+	}
+}
+
+// unindexSchemaLocked removes item from every registered index.
+func (ds *DataStore[T]) unindexSchemaLocked(id string, item T) {
+	for _, s := range ds.indexOrder {
+		s.remove(id, item)
+	}
+}
+
+// uniqueHoldersLocked returns the IDs of other items holding one of item's unique
+// values, to be replaced by item. It fails with ErrDuplicate if one of them is held on
+// an index that rejects duplicates.
+func (ds *DataStore[T]) uniqueHoldersLocked(id string, item T) ([]string, error) {
+	var holders []string
+	for _, s := range ds.indexOrder {
+		if s.kind != uniqueIndex {
+			continue
+		}
+		for _, v := range s.extract(item) {
+			other, ok := s.owners[v]
+			if !ok || other == id {
+				continue
+			}
+			if s.conflict == ConflictReject {
+				return nil, fmt.Errorf("%w: %s %q is held by %q", ErrDuplicate, s.name, v, other)
+			}
+			holders = append(holders, other)
+		}
+	}
+	return holders, nil
+}
+
+// GetBy returns the item holding value on the unique index name. It reports false if no
+// item holds it or name is not a unique index.
+func (ds *DataStore[T]) GetBy(name, value string) (T, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	var zero T
+	s, ok := ds.indexes[name]
+	if !ok || s.kind != uniqueIndex {
+		return zero, false
+	}
+	id, ok := s.owners[normalize(s.norm, value)]
+	if !ok {
+		return zero, false
+	}
+	return ds.items[id], true
+}
+
+// hasUniqueLocked reports whether any unique index is registered.
+func (ds *DataStore[T]) hasUniqueLocked() bool {
+	for _, s := range ds.indexOrder {
+		if s.kind == uniqueIndex {
+			return true
+		}
+	}
+	return false
+}
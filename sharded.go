@@ -0,0 +1,508 @@
+package matrixsearch
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// ShardedDataStore spreads items across several DataStores by hashing their IDs, so a
+// write only locks the shard that owns the item. Queries fan out to every shard and
+// the results are merged. Batches are applied per shard and are not atomic across shards;
+// Txn locks every shard and is. It has the methods of DataStore; those that need the
+// whole index at once, such as Stats, Explain, Snapshot and the dumps, copy the shards
+// into one index first.
+type ShardedDataStore[T any] struct {
+	shards []*DataStore[T]
+	getID  func(T) string
+	// opts holds the options shared by the shards. Search hooks are called once per
+	// fan-out from here rather than once per shard.
+	opts options
+}
+
+// NewShardedDataStore creates a store with n shards, each configured with opts. n is
+// raised to 1 if smaller. Hooks see inserts and deletes from every shard, and one
+// OnSearch call per search across all shards. It panics if opts register a unique
+// index, since a shard cannot see the values held by the others.
+func NewShardedDataStore[T any](n int, getID func(T) string, indexer func(T) []string, opts ...Option) *ShardedDataStore[T] {
+	if n < 1 {
+		n = 1
+	}
+	s := &ShardedDataStore[T]{
+		shards: make([]*DataStore[T], n),
+		getID:  getID,
+	}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	for _, x := range s.opts.indexes {
+		if idx, ok := x.(Index[T]); ok && idx.kind == uniqueIndex {
+			panic(fmt.Sprintf("matrixsearch: unique index %q on a sharded store", idx.name))
+		}
+	}
+	for i := range s.shards {
+		s.shards[i] = NewDataStore(getID, indexer, opts...)
+	}
+	return s
+}
+
+func (s *ShardedDataStore[T]) shardIndex(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(s.shards)))
+}
+
+func (s *ShardedDataStore[T]) shard(id string) *DataStore[T] {
+	return s.shards[s.shardIndex(id)]
+}
+
+func (s *ShardedDataStore[T]) Insert(item T) error {
+	return s.shard(s.getID(item)).Insert(item)
+}
+
+func (s *ShardedDataStore[T]) Delete(item T) {
+	s.shard(s.getID(item)).Delete(item)
+}
+
+func (s *ShardedDataStore[T]) DeleteByID(id string) bool {
+	return s.shard(id).DeleteByID(id)
+}
+
+func (s *ShardedDataStore[T]) Update(item T) error {
+	return s.shard(s.getID(item)).Update(item)
+}
+
+func (s *ShardedDataStore[T]) InsertMany(items []T) error {
+	ops := make([]Op[T], len(items))
+	for i, item := range items {
+		ops[i] = InsertOp(item)
+	}
+	return s.ApplyBatch(ops)
+}
+
+func (s *ShardedDataStore[T]) DeleteMany(items []T) int {
+	perShard := make([][]T, len(s.shards))
+	for _, item := range items {
+		i := s.shardIndex(s.getID(item))
+		perShard[i] = append(perShard[i], item)
+	}
+	removed := 0
+	for i, batch := range perShard {
+		if len(batch) > 0 {
+			removed += s.shards[i].DeleteMany(batch)
+		}
+	}
+	return removed
+}
+
+// ApplyBatch groups ops by shard and applies each group under that shard's lock. A
+// failing group does not stop the others, so the batch may be applied in part; the
+// errors of every failing shard are returned joined.
+func (s *ShardedDataStore[T]) ApplyBatch(ops []Op[T]) error {
+	perShard := make([][]Op[T], len(s.shards))
+	for _, op := range ops {
+		id := op.ID
+		if op.Kind != OpDelete || id == "" {
+			id = s.getID(op.Item)
+		}
+		i := s.shardIndex(id)
+		perShard[i] = append(perShard[i], op)
+	}
+	var errs []error
+	for i, batch := range perShard {
+		if len(batch) > 0 {
+			if err := s.shards[i].ApplyBatch(batch); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Txn runs fn while holding the write lock of every shard, so unlike ApplyBatch it is
+// atomic across shards. It otherwise behaves like DataStore.Txn; the hooks run once
+// every shard is unlocked.
+func (s *ShardedDataStore[T]) Txn(fn func(tx *Txn[T]) error) error {
+	tx := &Txn[T]{shards: make([]*Txn[T], len(s.shards)), shardOf: s.shardIndex}
+	for i, sh := range s.shards {
+		sh.mu.Lock()
+		tx.shards[i] = sh.beginLocked()
+	}
+	defer s.commitTxn(tx)
+	return tx.run(fn)
+}
+
+// commitTxn commits and unlocks every shard of tx, then reports its writes to the hooks
+// in the order they were made.
+func (s *ShardedDataStore[T]) commitTxn(tx *Txn[T]) {
+	events := make([][]hookEvent, len(s.shards))
+	for i, sh := range s.shards {
+		events[i] = sh.commitLocked()
+		sh.mu.Unlock()
+	}
+	ordered := make([]hookEvent, 0, len(tx.order))
+	for _, i := range tx.order {
+		ordered = append(ordered, events[i][0])
+		events[i] = events[i][1:]
+	}
+	s.opts.runHooks(ordered)
+}
+
+func (s *ShardedDataStore[T]) Get(id string) (T, bool) {
+	return s.shard(id).Get(id)
+}
+
+func (s *ShardedDataStore[T]) GetWithVersion(id string) (T, uint64, bool) {
+	return s.shard(id).GetWithVersion(id)
+}
+
+func (s *ShardedDataStore[T]) CompareAndSwap(id string, expected uint64, item T) (bool, error) {
+	return s.shard(id).CompareAndSwap(id, expected, item)
+}
+
+func (s *ShardedDataStore[T]) GetMany(ids []string) []T {
+	var results []T
+	for _, id := range ids {
+		if item, ok := s.Get(id); ok {
+			results = append(results, item)
+		}
+	}
+	return results
+}
+
+func (s *ShardedDataStore[T]) Has(id string) bool {
+	return s.shard(id).Has(id)
+}
+
+func (s *ShardedDataStore[T]) IDs() []string {
+	var ids []string
+	for _, sh := range s.shards {
+		ids = append(ids, sh.IDs()...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *ShardedDataStore[T]) All() []T {
+	var results []T
+	for _, sh := range s.shards {
+		results = append(results, sh.All()...)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return s.getID(results[i]) < s.getID(results[j])
+	})
+	return results
+}
+
+func (s *ShardedDataStore[T]) Search(query string) []T {
+	if s.opts.hooks == nil {
+		return s.search(query)
+	}
+	start := time.Now()
+	results := s.search(query)
+	s.opts.hooks.OnSearch(query, len(results), time.Since(start))
+	return results
+}
+
+func (s *ShardedDataStore[T]) search(query string) []T {
+	var results []T
+	for _, sh := range s.shards {
+		results = append(results, sh.search(query)...)
+	}
+	return results
+}
+
+// SearchRandom picks a shard with probability proportional to its number of matches
+// and returns a random match from it, so every matching item is equally likely.
+func (s *ShardedDataStore[T]) SearchRandom(query string) (T, bool) {
+	if s.opts.hooks == nil {
+		return s.searchRandom(query)
+	}
+	start := time.Now()
+	item, ok := s.searchRandom(query)
+	s.opts.hooks.OnSearch(query, hitCount(ok), time.Since(start))
+	return item, ok
+}
+
+func (s *ShardedDataStore[T]) searchRandom(query string) (T, bool) {
+	counts := make([]int, len(s.shards))
+	total := 0
+	for i, sh := range s.shards {
+		counts[i] = sh.matchCount(query)
+		total += counts[i]
+	}
+	if total > 0 {
+		n := rand.Intn(total)
+		for i, c := range counts {
+			if n < c {
+				if item, ok := s.shards[i].searchRandom(query); ok {
+					return item, true
+				}
+				break
+			}
+			n -= c
+		}
+		// The chosen shard changed since it was counted; take any remaining match.
+		for _, sh := range s.shards {
+			if item, ok := sh.searchRandom(query); ok {
+				return item, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// GetBy asks every shard for the item holding value on the unique index name, like
+// DataStore.GetBy. NewShardedDataStore refuses unique indexes, so it always reports
+// false; it is there so a ShardedDataStore can stand in for a DataStore.
+func (s *ShardedDataStore[T]) GetBy(name, value string) (T, bool) {
+	for _, sh := range s.shards {
+		if item, ok := sh.GetBy(name, value); ok {
+			return item, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// KeyCount returns the sum of the shards' key counts. A key held by several shards is
+// counted once per shard.
+func (s *ShardedDataStore[T]) KeyCount() int {
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.KeyCount()
+	}
+	return total
+}
+
+func (s *ShardedDataStore[T]) Count() int {
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.Count()
+	}
+	return total
+}
+
+func (s *ShardedDataStore[T]) Clear() {
+	for _, sh := range s.shards {
+		sh.Clear()
+	}
+}
+
+// Publish publishes the pending writes of every shard, like DataStore.Publish.
+func (s *ShardedDataStore[T]) Publish() {
+	for _, sh := range s.shards {
+		sh.Publish()
+	}
+}
+
+// merged returns a DataStore holding the items, composite index and registered indexes
+// of every shard, read one shard at a time, for the methods that need the whole index at
+// once. With index false only the fields are merged.
+func (s *ShardedDataStore[T]) merged(index bool) *DataStore[T] {
+	m := s.newMerged()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		m.mergeLocked(sh, index)
+		sh.mu.RUnlock()
+	}
+	return m
+}
+
+func (s *ShardedDataStore[T]) newMerged() *DataStore[T] {
+	m := &DataStore[T]{
+		items:          make(map[string]T),
+		itemKeys:       make(map[string][]string),
+		versions:       make(map[string]uint64),
+		compositeIndex: make(map[string][]string),
+		getID:          s.getID,
+		opts:           s.shards[0].opts,
+		fieldRank:      make(map[string]int),
+		fieldValues:    make(map[string]map[string]int),
+		fieldNumbers:   make(map[string]*rangeList),
+	}
+	m.buildIndexes()
+	return m
+}
+
+// mergeLocked adds the fields of sh, which must be locked, to ds and, with index true,
+// its items and indexes as well.
+func (ds *DataStore[T]) mergeLocked(sh *DataStore[T], index bool) {
+	fields := make([]string, 0, len(sh.fieldRank))
+	for field := range sh.fieldRank {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return sh.fieldRank[fields[i]] < sh.fieldRank[fields[j]] })
+	for _, field := range fields {
+		if _, ok := ds.fieldRank[field]; !ok {
+			ds.fieldRank[field] = len(ds.fieldRank)
+		}
+		for value, n := range sh.fieldValues[field] {
+			ds.countValueLocked(field, value, n)
+		}
+	}
+	if !index {
+		return
+	}
+	for id, item := range sh.items {
+		ds.items[id] = item
+		ds.itemKeys[id] = sh.itemKeys[id]
+		ds.versions[id] = sh.versions[id]
+		ds.indexSchemaLocked(id, item)
+	}
+	for key, ids := range sh.compositeIndex {
+		ds.compositeIndex[key] = append(ds.compositeIndex[key], ids...)
+	}
+}
+
+// Snapshot returns a consistent read-only view of every shard. It read-locks all the
+// shards at once and copies them, so unlike DataStore.Snapshot it costs a full copy of
+// the store on every call and holds up writers while it runs.
+func (s *ShardedDataStore[T]) Snapshot() *Snapshot[T] {
+	m := s.newMerged()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+	for _, sh := range s.shards {
+		m.mergeLocked(sh, true)
+	}
+	for _, sh := range s.shards {
+		sh.mu.RUnlock()
+	}
+	return m.buildSnapshotLocked()
+}
+
+// Compile returns the search keys q expands to, like DataStore.Compile, with the fields
+// ranked as the shards first saw them.
+func (s *ShardedDataStore[T]) Compile(q *Query) ([]string, error) {
+	return s.merged(false).Compile(q)
+}
+
+// Stats returns the statistics of the shards' merged index, like DataStore.Stats. It
+// copies the index of every shard, so it costs more than on a DataStore.
+func (s *ShardedDataStore[T]) Stats() Stats {
+	return s.merged(true).Stats()
+}
+
+// Explain returns the plan for query over the shards' merged index, like
+// DataStore.Explain. It copies the index of every shard, so it is meant for debugging
+// rather than the request path.
+func (s *ShardedDataStore[T]) Explain(query string) *Plan {
+	return s.merged(true).Explain(query)
+}
+
+// Dump writes the keys and items of every shard to filename, like DataStore.Dump.
+func (s *ShardedDataStore[T]) Dump(filename string) error {
+	return s.merged(true).Dump(filename)
+}
+
+func (s *ShardedDataStore[T]) DumpTo(w io.Writer, format DumpFormat) error {
+	return s.DumpWith(w, format, DumpOptions{})
+}
+
+func (s *ShardedDataStore[T]) DumpWith(w io.Writer, format DumpFormat, opts DumpOptions) error {
+	return s.merged(true).DumpWith(w, format, opts)
+}
+
+func (s *ShardedDataStore[T]) DumpSVG(w io.Writer) error {
+	return s.DumpTo(w, DumpFormatSVG)
+}
+
+func (s *ShardedDataStore[T]) DumpDOT(w io.Writer) error {
+	return s.DumpTo(w, DumpFormatDOT)
+}
+
+// Query runs q on every shard and merges the results. A field only has to be known to
+// one shard.
+func (s *ShardedDataStore[T]) Query(q *Query) ([]T, error) {
+	if s.opts.hooks == nil {
+		return s.query(q)
+	}
+	start := time.Now()
+	results, err := s.query(q)
+	s.opts.hooks.OnSearch(q.String(), len(results), time.Since(start))
+	return results, s.opts.reportError("query", err)
+}
+
+func (s *ShardedDataStore[T]) query(q *Query) ([]T, error) {
+	var results []T
+	var unknown error
+	known := false
+	for _, sh := range s.shards {
+		res, err := sh.query(q)
+		if errors.Is(err, ErrUnknownField) {
+			unknown = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		known = true
+		results = append(results, res...)
+	}
+	if !known {
+		return nil, unknown
+	}
+	return results, nil
+}
+
+// QueryRandom picks a shard with probability proportional to its number of matches and
+// returns a random match from it.
+func (s *ShardedDataStore[T]) QueryRandom(q *Query) (T, bool, error) {
+	if s.opts.hooks == nil {
+		return s.queryRandom(q)
+	}
+	start := time.Now()
+	item, ok, err := s.queryRandom(q)
+	s.opts.hooks.OnSearch(q.String(), hitCount(ok), time.Since(start))
+	return item, ok, s.opts.reportError("query", err)
+}
+
+func (s *ShardedDataStore[T]) queryRandom(q *Query) (T, bool, error) {
+	var zero T
+	counts := make([]int, len(s.shards))
+	total := 0
+	var unknown error
+	known := false
+	for i, sh := range s.shards {
+		n, err := sh.queryCount(q)
+		if errors.Is(err, ErrUnknownField) {
+			unknown = err
+			continue
+		}
+		if err != nil {
+			return zero, false, err
+		}
+		known = true
+		counts[i] = n
+		total += n
+	}
+	if !known {
+		return zero, false, unknown
+	}
+	if total == 0 {
+		return zero, false, nil
+	}
+	n := rand.Intn(total)
+	for i, c := range counts {
+		if n < c {
+			if item, ok, err := s.shards[i].queryRandom(q); ok || err != nil {
+				return item, ok, err
+			}
+			break
+		}
+		n -= c
+	}
+	// The chosen shard changed since it was counted; take any remaining match.
+	for _, sh := range s.shards {
+		if item, ok, _ := sh.queryRandom(q); ok {
+			return item, true, nil
+		}
+	}
+	return zero, false, nil
+}
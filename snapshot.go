@@ -0,0 +1,227 @@
+package matrixsearch
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Snapshot is an immutable, consistent view of a DataStore. Items and posting lists are
+// held in persistent hash tries, so publishing a new snapshot only copies the trie nodes
+// on the path to each item and key that writes touched and shares the rest with the
+// previous one.
+type Snapshot[T any] struct {
+	gen   uint64
+	opts  *options
+	items pmap[snapshotItem[T]]
+	index pmap[[]string]
+}
+
+// snapshotItem is an item with its composite keys and version.
+type snapshotItem[T any] struct {
+	item    T
+	keys    []string
+	version uint64
+}
+
+func (s *Snapshot[T]) lookup(key string) []string {
+	return s.opts.resolve(key, s.indexed, s.keysOf)
+}
+
+// keysOf returns the composite keys of the item id.
+func (s *Snapshot[T]) keysOf(id string) []string {
+	it, _ := s.items.get(id)
+	return it.keys
+}
+
+// indexed reads the posting list of a materialized key.
+func (s *Snapshot[T]) indexed(key string) ([]string, bool) {
+	return s.index.get(key)
+}
+
+func (s *Snapshot[T]) Get(id string) (T, bool) {
+	it, ok := s.items.get(id)
+	return it.item, ok
+}
+
+// GetWithVersion returns the item id together with its version, like
+// DataStore.GetWithVersion.
+func (s *Snapshot[T]) GetWithVersion(id string) (T, uint64, bool) {
+	it, ok := s.items.get(id)
+	return it.item, it.version, ok
+}
+
+// GetMany returns the items stored under ids, in the same order. Unknown IDs are skipped.
+func (s *Snapshot[T]) GetMany(ids []string) []T {
+	var results []T
+	for _, id := range ids {
+		if item, ok := s.Get(id); ok {
+			results = append(results, item)
+		}
+	}
+	return results
+}
+
+func (s *Snapshot[T]) Has(id string) bool {
+	_, ok := s.items.get(id)
+	return ok
+}
+
+func (s *Snapshot[T]) Count() int {
+	return s.items.len
+}
+
+// IDs returns the IDs of all items in the snapshot in sorted order.
+func (s *Snapshot[T]) IDs() []string {
+	ids := make([]string, 0, s.items.len)
+	s.items.each(func(id string, _ snapshotItem[T]) {
+		ids = append(ids, id)
+	})
+	sort.Strings(ids)
+	return ids
+}
+
+// All returns every item in the snapshot, ordered by ID.
+func (s *Snapshot[T]) All() []T {
+	ids := s.IDs()
+	results := make([]T, len(ids))
+	for i, id := range ids {
+		results[i], _ = s.Get(id)
+	}
+	return results
+}
+
+func (s *Snapshot[T]) Search(query string) []T {
+	return s.search(s.opts.searchKey(query))
+}
+
+func (s *Snapshot[T]) search(key string) []T {
+	if ids := s.lookup(key); ids != nil {
+		var results []T
+		for _, id := range ids {
+			item, _ := s.Get(id)
+			results = append(results, item)
+		}
+		return results
+	}
+	return nil
+}
+
+func (s *Snapshot[T]) SearchRandom(query string) (T, bool) {
+	return s.searchRandom(s.opts.searchKey(query))
+}
+
+func (s *Snapshot[T]) searchRandom(key string) (T, bool) {
+	if ids := s.lookup(key); len(ids) > 0 {
+		return s.Get(ids[rand.Intn(len(ids))])
+	}
+	var zero T
+	return zero, false
+}
+
+// Snapshot returns a consistent read-only view of the store. With snapshot reads
+// enabled it returns the most recently published snapshot; otherwise it is built from
+// the current state and reused until the next write.
+func (ds *DataStore[T]) Snapshot() *Snapshot[T] {
+	if ds.opts.snapshotReads {
+		return ds.snap.Load()
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if s := ds.snap.Load(); s != nil && s.gen == ds.gen {
+		return s
+	}
+	s := ds.buildSnapshotLocked()
+	ds.snap.Store(s)
+	return s
+}
+
+// Publish makes writes that are waiting for the next batched publication visible to
+// snapshot readers. It does nothing unless snapshot reads are enabled.
+func (ds *DataStore[T]) Publish() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.publishPending = false
+	if ds.opts.snapshotReads {
+		ds.publishLocked()
+	}
+}
+
+// writeUnlock finishes a write: it commits it, releases the lock and then reports the
+// write to the hooks.
+func (ds *DataStore[T]) writeUnlock() {
+	events := ds.commitLocked()
+	ds.mu.Unlock()
+	ds.opts.runHooks(events)
+}
+
+// commitLocked advances the store generation, publishes or schedules a snapshot when
+// snapshot reads are enabled, and returns the hook events of the write.
+func (ds *DataStore[T]) commitLocked() []hookEvent {
+	ds.gen++
+	if ds.opts.snapshotReads {
+		if ds.opts.publishInterval <= 0 {
+			ds.publishLocked()
+		} else if !ds.publishPending {
+			ds.publishPending = true
+			time.AfterFunc(ds.opts.publishInterval, ds.Publish)
+		}
+	}
+	events := ds.events
+	ds.events = nil
+	return events
+}
+
+// touchLocked records that id and keys changed since the last published snapshot.
+func (ds *DataStore[T]) touchLocked(id string, keys []string) {
+	if !ds.opts.snapshotReads {
+		return
+	}
+	ds.dirtyIDs[id] = struct{}{}
+	for _, key := range keys {
+		ds.dirtyKeys[key] = struct{}{}
+	}
+}
+
+func (ds *DataStore[T]) buildSnapshotLocked() *Snapshot[T] {
+	s := &Snapshot[T]{gen: ds.gen, opts: &ds.opts}
+	edit := newEdit()
+	for id, item := range ds.items {
+		s.items.set(edit, id, snapshotItem[T]{item, ds.itemKeys[id], ds.versions[id]})
+	}
+	for key, ids := range ds.compositeIndex {
+		s.index.set(edit, key, ids)
+	}
+	return s
+}
+
+func (ds *DataStore[T]) publishLocked() {
+	old := ds.snap.Load()
+	var s *Snapshot[T]
+	if old == nil || ds.rebuildAll {
+		s = ds.buildSnapshotLocked()
+	} else {
+		next := *old
+		next.gen = ds.gen
+		edit := newEdit()
+		for id := range ds.dirtyIDs {
+			if item, ok := ds.items[id]; ok {
+				next.items.set(edit, id, snapshotItem[T]{item, ds.itemKeys[id], ds.versions[id]})
+			} else {
+				next.items.delete(edit, id)
+			}
+		}
+		for key := range ds.dirtyKeys {
+			if ids, ok := ds.compositeIndex[key]; ok {
+				next.index.set(edit, key, ids)
+			} else {
+				next.index.delete(edit, key)
+			}
+		}
+		s = &next
+	}
+	ds.snap.Store(s)
+	ds.rebuildAll = false
+	ds.dirtyIDs = make(map[string]struct{})
+	ds.dirtyKeys = make(map[string]struct{})
+}
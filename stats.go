@@ -0,0 +1,211 @@
+package matrixsearch
+
+import (
+	"math/bits"
+	"reflect"
+	"slices"
+	"sort"
+	"unsafe"
+)
+
+// largestKeys is the number of keys reported in Stats.LargestKeys.
+const largestKeys = 10
+
+// Stats describes the index of a DataStore at one point in time.
+type Stats struct {
+	Items int
+	// Keys counts the composite keys, including EmptyKeys.
+	Keys int
+	// KeysByLevel counts the keys by their number of field:value pairs.
+	KeysByLevel map[int]int
+	// PostingLists is a histogram of posting list lengths in power-of-two buckets.
+	PostingLists []PostingBucket
+	// LargestKeys lists the keys with the longest posting lists, longest first.
+	LargestKeys []KeyStat
+	// EmptyKeys counts the keys whose items have all been deleted. They are kept until
+	// the store is cleared.
+	EmptyKeys int
+	// Inconsistent lists the IDs of items whose posting list entries do not match the
+	// keys recorded for them, of items whose entries in the indexes registered with
+	// WithIndexes do not match their values, and of IDs in posting lists or indexes that
+	// are not stored. It should always be empty.
+	Inconsistent []string
+	Memory       MemoryStats
+}
+
+// PostingBucket counts the keys whose posting lists hold between Min and Max items.
+type PostingBucket struct {
+	Min, Max int
+	Keys     int
+}
+
+// KeyStat is a key and the length of its posting list.
+type KeyStat struct {
+	Key   string
+	Items int
+}
+
+// MemoryStats estimates the bytes held by each structure of a store. Items are counted
+// by the size of T alone, without memory they point to, and strings shared between
+// structures are counted once.
+type MemoryStats struct {
+	Items    int64
+	Index    int64
+	ItemKeys int64
+	Fields   int64
+	// Indexes covers the indexes registered with WithIndexes.
+	Indexes int64
+	Total   int64
+}
+
+// Rough per-entry costs of Go maps, slices and strings.
+const (
+	mapEntryOverhead = 16
+	sliceHeaderSize  = int64(unsafe.Sizeof([]string(nil)))
+	stringHeaderSize = int64(unsafe.Sizeof(""))
+)
+
+// Stats returns statistics about the store's index and checks it for inconsistencies.
+// It visits every posting list, so it is meant for periodic monitoring rather than the
+// request path.
+func (ds *DataStore[T]) Stats() Stats {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	s := Stats{
+		Items:       len(ds.items),
+		Keys:        len(ds.compositeIndex),
+		KeysByLevel: make(map[int]int),
+	}
+
+	// seen counts the posting list entries of each ID, to be compared with the number
+	// of keys recorded for the item.
+	seen := make(map[string]int, len(ds.items))
+	orphans := make(map[string]bool)
+	for key, ids := range ds.compositeIndex {
+		s.KeysByLevel[keyPairs(key)]++
+		if len(ids) == 0 {
+			s.EmptyKeys++
+		}
+		s.addPostingList(len(ids))
+		s.LargestKeys = append(s.LargestKeys, KeyStat{Key: key, Items: len(ids)})
+		for _, id := range ids {
+			if _, ok := ds.items[id]; !ok {
+				orphans[id] = true
+			}
+			seen[id]++
+		}
+		s.Memory.Index += mapEntryOverhead + stringHeaderSize + int64(len(key)) + sliceHeaderSize + int64(cap(ids))*stringHeaderSize
+	}
+	sort.Slice(s.LargestKeys, func(i, j int) bool {
+		a, b := s.LargestKeys[i], s.LargestKeys[j]
+		if a.Items != b.Items {
+			return a.Items > b.Items
+		}
+		return a.Key < b.Key
+	})
+	if len(s.LargestKeys) > largestKeys {
+		s.LargestKeys = s.LargestKeys[:largestKeys]
+	}
+
+	itemSize := int64(reflect.TypeOf((*T)(nil)).Elem().Size())
+	for id := range ds.items {
+		keys, ok := ds.itemKeys[id]
+		if !ok || seen[id] != len(keys) {
+			orphans[id] = true
+		}
+		s.Memory.Items += mapEntryOverhead + stringHeaderSize + int64(len(id)) + itemSize
+		s.Memory.ItemKeys += mapEntryOverhead + stringHeaderSize + sliceHeaderSize + int64(cap(keys))*stringHeaderSize
+	}
+	for _, idx := range ds.indexOrder {
+		s.Memory.Indexes += idx.check(ds.items, orphans)
+	}
+	for id := range orphans {
+		s.Inconsistent = append(s.Inconsistent, id)
+	}
+	sort.Strings(s.Inconsistent)
+
+	for field, values := range ds.fieldValues {
+		s.Memory.Fields += mapEntryOverhead + stringHeaderSize + int64(len(field))
+		for value := range values {
+			s.Memory.Fields += mapEntryOverhead + stringHeaderSize + int64(len(value)) + 8
+		}
+	}
+	for _, numbers := range ds.fieldNumbers {
+		for _, chunk := range numbers.chunks {
+			s.Memory.Fields += sliceHeaderSize + int64(cap(chunk))*int64(unsafe.Sizeof(rangeEntry{}))
+		}
+	}
+	s.Memory.Total = s.Memory.Items + s.Memory.Index + s.Memory.ItemKeys + s.Memory.Fields + s.Memory.Indexes
+	return s
+}
+
+// check adds to bad the IDs whose entries in s do not match the values of their items,
+// or that are not stored, and returns the estimated bytes held by s.
+func (s *schemaIndex[T]) check(items map[string]T, bad map[string]bool) int64 {
+	var mem int64
+	seen := make(map[string]int, len(items))
+	if s.kind == rangeIndex {
+		entrySize := int64(unsafe.Sizeof(rangeEntry{}))
+		for _, chunk := range s.sorted.chunks {
+			mem += sliceHeaderSize + int64(cap(chunk))*entrySize
+			for _, e := range chunk {
+				if item, ok := items[e.id]; !ok || s.number(item) != e.value {
+					bad[e.id] = true
+				}
+				seen[e.id]++
+			}
+		}
+		for id, item := range items {
+			if f := s.number(item); f == f && seen[id] != 1 {
+				bad[id] = true
+			}
+		}
+		return mem
+	}
+
+	values := make(map[string][]string, len(items))
+	for id, item := range items {
+		values[id] = s.extract(item)
+	}
+	holds := func(id, v string) bool {
+		vs, ok := values[id]
+		return ok && slices.Contains(vs, v)
+	}
+	for v, id := range s.owners {
+		mem += mapEntryOverhead + 2*stringHeaderSize + int64(len(v))
+		if !holds(id, v) {
+			bad[id] = true
+		}
+		seen[id]++
+	}
+	for v, ids := range s.postings {
+		mem += mapEntryOverhead + stringHeaderSize + int64(len(v)) + sliceHeaderSize + int64(cap(ids))*stringHeaderSize
+		for _, id := range ids {
+			if !holds(id, v) {
+				bad[id] = true
+			}
+			seen[id]++
+		}
+	}
+	for id, vs := range values {
+		if seen[id] != len(vs) {
+			bad[id] = true
+		}
+	}
+	return mem
+}
+
+// addPostingList counts a posting list of length n in the histogram. Bucket 0 holds
+// empty lists and bucket i lengths from 2^(i-1) to 2^i-1.
+func (s *Stats) addPostingList(n int) {
+	i := bits.Len(uint(n))
+	for len(s.PostingLists) <= i {
+		b := len(s.PostingLists)
+		bucket := PostingBucket{}
+		if b > 0 {
+			bucket.Min, bucket.Max = 1<<(b-1), 1<<b-1
+		}
+		s.PostingLists = append(s.PostingLists, bucket)
+	}
+	s.PostingLists[i].Keys++
+}
@@ -0,0 +1,203 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type Pool struct {
+	ID        string            `text:"id"`
+	Tags      []string          `text:"tags"`
+	Ports     [2]int            `text:"port"`
+	Labels    map[string]string `text:"labels"`
+	Protocols []string
+}
+
+func TestAutoIndexerCollections(t *testing.T) {
+	p := Pool{
+		ID:     "p1",
+		Tags:   []string{"residential", "rotating"},
+		Ports:  [2]int{80, 443},
+		Labels: map[string]string{"region": "eu", "env": "prod"},
+	}
+	want := []string{"id:p1", "tags:residential", "tags:rotating", "port:80", "port:443", "labels.env:prod", "labels.region:eu"}
+	if got := matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+
+	ds := matrixsearch.NewDataStore(func(p Pool) string { return p.ID }, matrixsearch.AutoIndexer[Pool])
+	ds.Insert(p)
+	ds.Insert(Pool{ID: "p2", Tags: []string{"datacenter", "rotating"}})
+	if got := len(ds.Search("tags:rotating")); got != 2 {
+		t.Errorf("Expected 2 pools tagged rotating, got %d", got)
+	}
+	if got := len(ds.Search("tags:residential:tags:rotating")); got != 1 {
+		t.Errorf("Expected 1 pool tagged residential and rotating, got %d", got)
+	}
+	if got := len(ds.Search("labels.env:prod")); got != 1 {
+		t.Errorf("Expected 1 pool labelled env=prod, got %d", got)
+	}
+}
+
+func TestAutoIndexerRepeatedElements(t *testing.T) {
+	p := Pool{ID: "p1", Tags: []string{"a", "b", "a"}, Ports: [2]int{80, 80}}
+	want := []string{"id:p1", "tags:a", "tags:b", "port:80"}
+	if got := matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+	for i := 0; i < 40; i++ {
+		p.Tags = append(p.Tags, "t"+strconv.Itoa(i%20))
+	}
+	if got := len(matrixsearch.AutoIndexer(p)); got != 24 {
+		t.Errorf("Expected 24 distinct keys, got %d", got)
+	}
+
+	p.Tags = []string{"a", "a"}
+	ds := matrixsearch.NewDataStore(func(p Pool) string { return p.ID }, matrixsearch.AutoIndexer[Pool])
+	ds.Insert(p)
+	if got := len(ds.Search("tags:a")); got != 1 {
+		t.Errorf("Expected Search to return the item once, got %d", got)
+	}
+	if got, err := ds.Query(matrixsearch.Q().Eq("tags", "a")); err != nil || len(got) != 1 {
+		t.Errorf("Expected Query to return the item once, got %d, %v", len(got), err)
+	}
+}
+
+func TestAutoIndexerNestedTags(t *testing.T) {
+	c := Car{
+		Model:        "Model3",
+		Brand:        "Tesla",
+		Year:         2021,
+		Color:        "Blue",
+		Engine:       Engine{Type: "Electric", Horsepower: 450},
+		Manufacturer: Manufacturer{Name: "Tesla Inc.", Country: "US"},
+		Price:        50000,
+		Previous:     &Car{Model: "ModelS", Engine: Engine{Type: "Electric"}},
+	}
+	want := []string{
+		"model:Model3", "brand:Tesla", "year:2021", "color:Blue",
+		"type:Electric", "horsepower:450", "capacity:0", "name:Tesla Inc.", "country:US", "price:50000",
+		"previous.model:ModelS", "previous.year:0",
+		"previous.type:Electric", "previous.horsepower:0", "previous.capacity:0", "previous.price:0",
+	}
+	if got := matrixsearch.AutoIndexer(c); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+}
+
+func TestAutoIndexerUntaggedStructs(t *testing.T) {
+	f := Fruit{Name: "Banana", Origin: Origin{Country: "Ecuador"}}
+	keys := matrixsearch.AutoIndexer(f)
+	found := false
+	for _, k := range keys {
+		if k == "country:Ecuador" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected untagged Origin to be indexed without a prefix, got %v", keys)
+	}
+}
+
+type Listing struct {
+	ID     string        `text:"id"`
+	Seller *Manufacturer `text:"seller"`
+	Engine *Engine
+	Rating *int   `text:"rating"`
+	Notes  string `text:"-"`
+}
+
+func TestAutoIndexerPointers(t *testing.T) {
+	l := Listing{ID: "l1", Notes: "ignored"}
+	if got, want := matrixsearch.AutoIndexer(l), []string{"id:l1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected nil pointers to be skipped, got %v", got)
+	}
+	rating := 5
+	l.Seller = &Manufacturer{Name: "Tesla Inc.", Country: "US"}
+	l.Engine = &Engine{Type: "Electric"}
+	l.Rating = &rating
+	want := []string{"id:l1", "seller.name:Tesla Inc.", "seller.country:US", "type:Electric", "horsepower:0", "capacity:0", "rating:5"}
+	if got := matrixsearch.AutoIndexer(&l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+}
+
+// modelKeys returns the model keys among keys, which is enough to tell which cars
+// in a chain were visited.
+func modelKeys(keys []string) []string {
+	var models []string
+	for _, k := range keys {
+		if strings.HasSuffix(k[:strings.Index(k, ":")], "model") {
+			models = append(models, k)
+		}
+	}
+	return models
+}
+
+func TestAutoIndexerSelfReferencing(t *testing.T) {
+	c := Car{Model: "a", Previous: &Car{Model: "b", Previous: &Car{Model: "c"}}}
+	want := []string{"model:a", "previous.model:b", "previous.previous.model:c"}
+	for i := 0; i < 2; i++ {
+		if got := modelKeys(matrixsearch.AutoIndexer(c)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+	}
+}
+
+func TestAutoIndexerCycles(t *testing.T) {
+	loop := &Car{Model: "a"}
+	loop.Previous = loop
+	ring := &Car{Model: "a", Previous: &Car{Model: "b"}}
+	ring.Previous.Previous = ring
+	tests := []struct {
+		item any
+		want []string
+	}{
+		{loop, []string{"model:a"}},
+		{*loop, []string{"model:a", "previous.model:a"}},
+		{ring, []string{"model:a", "previous.model:b"}},
+	}
+	for _, tt := range tests {
+		if got := modelKeys(matrixsearch.AutoIndexer(tt.item)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected keys %v, got %v", tt.want, got)
+		}
+	}
+
+	ds := matrixsearch.NewDataStore(func(c *Car) string { return c.Model }, matrixsearch.AutoIndexer[*Car])
+	ds.Insert(ring)
+	if got := len(ds.Search("model:a:previous.model:b")); got != 1 {
+		t.Errorf("Expected the cyclic item to be found, got %d", got)
+	}
+}
+
+func TestAutoIndexerSharedPlan(t *testing.T) {
+	// Manufacturer is indexed on its own and under the seller prefix from one plan.
+	m := Manufacturer{Name: "Tesla Inc.", Country: "US"}
+	l := Listing{ID: "l1", Seller: &m}
+	for i := 0; i < 2; i++ {
+		if got, want := matrixsearch.AutoIndexer(m), []string{"name:Tesla Inc.", "country:US"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+		if got, want := matrixsearch.AutoIndexer(l), []string{"id:l1", "seller.name:Tesla Inc.", "seller.country:US"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected keys %v, got %v", want, got)
+		}
+	}
+}
+
+func BenchmarkAutoIndexer(b *testing.B) {
+	c := Car{
+		Model:        "Model3",
+		Brand:        "Tesla",
+		Year:         2021,
+		Color:        "Blue",
+		Manufacturer: Manufacturer{Name: "Tesla Inc.", Country: "US"},
+		Price:        50000,
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		matrixsearch.AutoIndexer(c)
+	}
+}
@@ -28,6 +28,7 @@ type Car struct {
 	Engine       Engine       `faker:"-"`
 	Manufacturer Manufacturer `faker:"-"`
 	Price        float64      `faker:"boundary_start=20000, boundary_end=150000" text:"price"`
+	Previous     *Car         `faker:"-" text:"previous"`
 }
 
 func carIndexer(c Car) []string {
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Link struct {
+	ID      string        `text:"id"`
+	Speed   int           `text:"speed,bucket=0:75:150,extract=speedtype"`
+	Price   *float64      `text:"price,step=5,noraw"`
+	Latency time.Duration `text:"latency,noraw,bucket=0:0.1:1"`
+}
+
+func init() {
+	matrixsearch.RegisterExtractor("speedtype", func(v any) []string {
+		if v.(int) >= 100 {
+			return []string{"fast"}
+		}
+		return []string{"slow"}
+	})
+}
+
+func TestBucket(t *testing.T) {
+	cases := []struct {
+		v    float64
+		want string
+	}{
+		{-1, "<0"},
+		{0, "0-75"},
+		{100, "75-150"},
+		{150, "150+"},
+	}
+	for _, c := range cases {
+		if got := matrixsearch.Bucket(c.v, 0, 75, 150); got != c.want {
+			t.Errorf("Expected bucket %q for %v, got %q", c.want, c.v, got)
+		}
+	}
+	if got := matrixsearch.StepBucket(7.5, 5); got != "5-10" {
+		t.Errorf("Expected step bucket 5-10, got %q", got)
+	}
+}
+
+func TestAutoIndexerDerivedKeys(t *testing.T) {
+	price := 7.5
+	l := Link{ID: "1", Speed: 100, Price: &price, Latency: 250 * time.Millisecond}
+	want := []string{
+		"id:1",
+		"speed:100",
+		"speed.bucket:75-150",
+		"speedtype:fast",
+		"price.bucket:5-10",
+		"latency.bucket:0.1-1",
+	}
+	if got := matrixsearch.AutoIndexer(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+	if got := LinkIndexer(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %v, got %v", want, got)
+	}
+	want = []string{"id:2", "speed:0", "speed.bucket:0-75", "speedtype:slow", "latency.bucket:0-0.1"}
+	if got := matrixsearch.AutoIndexer(Link{ID: "2"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected nil price to be skipped, got %v", got)
+	}
+}
+
+func TestQueryDerivedKeys(t *testing.T) {
+	ds := matrixsearch.NewDataStore(LinkID, LinkIndexer)
+	ds.Insert(Link{ID: "1", Speed: 50})
+	ds.Insert(Link{ID: "2", Speed: 100})
+	ds.Insert(Link{ID: "3", Speed: 120})
+	if got := ds.Search("speed.bucket:75-150"); len(got) != 2 {
+		t.Errorf("Expected 2 links in the 75-150 bucket, got %d", len(got))
+	}
+	q := LinkQuery().SpeedBucket("75-150").Speedtype("fast")
+	if got, want := q.String(), "speed.bucket:75-150:speedtype:fast"; got != want {
+		t.Errorf("Expected query %q, got %q", want, got)
+	}
+	got, err := ds.Query(matrixsearch.Q().Eq("speedtype", "slow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "1" {
+		t.Errorf("Expected only link 1 to be slow, got %v", got)
+	}
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/xvertile/matrixsearch"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newFruitStore(opts ...matrixsearch.Option) *matrixsearch.DataStore[Fruit] {
+	ds := matrixsearch.NewDataStore(func(f Fruit) string { return f.Name }, func(f Fruit) []string {
+		return []string{"color:" + f.Color, "taste:" + f.Taste}
+	}, opts...)
+	ds.Insert(Fruit{Name: "apple", Color: "red", Taste: "sweet"})
+	ds.Insert(Fruit{Name: "lemon", Color: "yellow", Taste: "sour"})
+	ds.Insert(Fruit{Name: "cherry", Color: "red", Taste: "sweet"})
+	return ds
+}
+
+func TestDumpDOT(t *testing.T) {
+	var b strings.Builder
+	if err := newFruitStore().DumpDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	dot := b.String()
+	for _, want := range []string{
+		"digraph DataStore {",
+		"Total Keys: 6",
+		"Total Items: 3",
+		`"keyCategory" -> "keyLevel_1";`,
+		`"keyCategory" -> "keyLevel_2";`,
+		`"color:red:taste:sweet" -> "color:red:taste:sweet_item_cherry";`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected DOT output to contain %q", want)
+		}
+	}
+}
+
+func TestDumpSVG(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "fruits.svg")
+	if err := newFruitStore().Dump(filename); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := string(data)
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("Expected an SVG document, got %.80q", svg)
+	}
+	for _, want := range []string{"Simple Keys", "2-Component Keys", "color:yellow", "(2 items)", ">cherry<"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected SVG output to contain %q", want)
+		}
+	}
+}
+
+func TestDumpTooLarge(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	for i := 0; i < 1000; i++ {
+		p := randomProxy(i)
+		p.Geo.State = "state" + strconv.Itoa(i)
+		ds.Insert(p)
+	}
+	var b strings.Builder
+	if err := ds.DumpSVG(&b); !errors.Is(err, matrixsearch.ErrDumpTooLarge) {
+		t.Errorf("Expected ErrDumpTooLarge, got %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got %d bytes", b.Len())
+	}
+	if err := ds.DumpWith(&b, matrixsearch.DumpFormatSVG, matrixsearch.DumpOptions{Query: "state:state7", MaxDepth: 2}); err != nil {
+		t.Errorf("Expected a filtered dump to fit, got %v", err)
+	}
+}
+
+func TestDumpText(t *testing.T) {
+	var b strings.Builder
+	if err := newFruitStore(matrixsearch.WithDumpDirectItems(1)).DumpTo(&b, matrixsearch.DumpFormatText); err != nil {
+		t.Fatal(err)
+	}
+	want := `DataStore: 6 keys, 3 items
+Composite Keys
+|-- Simple Keys
+|   |-- color:red (2 items)
+|   |   ` + "`" + `-- 2 items
+|   |-- color:yellow (1 items)
+|   |   ` + "`" + `-- lemon
+|   |-- taste:sour (1 items)
+|   |   ` + "`" + `-- lemon
+|   ` + "`" + `-- taste:sweet (2 items)
+|       ` + "`" + `-- 2 items
+` + "`" + `-- 2-Component Keys
+    |-- color:red:taste:sweet (2 items)
+    |   ` + "`" + `-- 2 items
+    ` + "`" + `-- color:yellow:taste:sour (1 items)
+        ` + "`" + `-- lemon
+`
+	if got := b.String(); got != want {
+		t.Errorf("Expected text dump\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	var b strings.Builder
+	if err := newFruitStore().DumpTo(&b, matrixsearch.DumpFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var dump struct {
+		Keys   int
+		Items  int
+		Levels []struct {
+			Components int
+			Keys       []struct {
+				Key       string
+				Count     int
+				SampleIDs []string `json:"sample_ids"`
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(b.String()), &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Keys != 6 || dump.Items != 3 || len(dump.Levels) != 2 || dump.Levels[1].Components != 2 {
+		t.Fatalf("Unexpected JSON dump %+v", dump)
+	}
+	red := dump.Levels[0].Keys[0]
+	if red.Key != "color:red" || red.Count != 2 || strings.Join(red.SampleIDs, ",") != "apple,cherry" {
+		t.Errorf("Unexpected entry for color:red: %+v", red)
+	}
+}
+
+func TestDumpMermaidAndHTML(t *testing.T) {
+	ds := newFruitStore()
+	var mermaid, page strings.Builder
+	if err := ds.DumpTo(&mermaid, matrixsearch.DumpFormatMermaid); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mermaid.String(), "graph TD\n") || !strings.Contains(mermaid.String(), `("color:red<br/>(2 items)"):::key`) {
+		t.Errorf("Unexpected Mermaid dump:\n%s", mermaid.String())
+	}
+	if err := ds.DumpTo(&page, matrixsearch.DumpFormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page.String(), `<details class="key" data-key="color:red">`) || !strings.Contains(page.String(), "</html>") {
+		t.Errorf("Unexpected HTML dump:\n%s", page.String())
+	}
+	if err := ds.DumpTo(&page, "pdf"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestDumpWithOptions(t *testing.T) {
+	ds := newFruitStore()
+	cases := []struct {
+		opts matrixsearch.DumpOptions
+		want string
+	}{
+		{matrixsearch.DumpOptions{Query: "color:red", SampleItems: 1}, "DataStore: 2 keys, 2 items\nComposite Keys\n" +
+			"|-- Simple Keys\n|   `-- color:red (2 items)\n|       `-- 2 items\n" +
+			"`-- 2-Component Keys\n    `-- color:red:taste:sweet (2 items)\n        `-- 2 items\n"},
+		{matrixsearch.DumpOptions{MaxDepth: 1, Fields: []string{"taste"}}, "DataStore: 2 keys, 3 items\nComposite Keys\n" +
+			"`-- Simple Keys\n    |-- taste:sour (1 items)\n    |   `-- lemon\n    `-- taste:sweet (2 items)\n        |-- apple\n        `-- cherry\n"},
+		{matrixsearch.DumpOptions{MaxKeys: 1}, "DataStore: 1 of 6 keys, 3 items\nComposite Keys\n" +
+			"`-- Simple Keys\n    `-- color:red (2 items)\n        |-- apple\n        `-- cherry\n"},
+	}
+	for _, c := range cases {
+		var b strings.Builder
+		if err := ds.DumpWith(&b, matrixsearch.DumpFormatText, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != c.want {
+			t.Errorf("Expected dump with %+v\n%s\ngot\n%s", c.opts, c.want, got)
+		}
+	}
+}
+
+func TestDumpQueryWithCombinations(t *testing.T) {
+	ds := newFruitStore(matrixsearch.WithCombinations("taste+color"))
+	var b strings.Builder
+	if err := ds.DumpWith(&b, matrixsearch.DumpFormatText, matrixsearch.DumpOptions{Query: "color:red:taste:sweet", SampleItems: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want := "DataStore: 1 keys, 2 items\nComposite Keys\n" +
+		"`-- 2-Component Keys\n    `-- taste:sweet:color:red (2 items)\n        `-- 2 items\n"
+	if got := b.String(); got != want {
+		t.Errorf("Expected the query to be resolved by the planner\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	ds := newFruitStore()
+	cases := []struct {
+		query    string
+		actual   int
+		matching int
+		reason   string
+	}{
+		{"color:red", 2, 2, "the composite key holds 2 items"},
+		{"taste:sweet:color:red", 0, 2, `2 items match, but the terms are out of indexer order; search for "color:red:taste:sweet"`},
+		{"colour:red", 0, 0, `no item has a field "colour"; check the spelling`},
+		{"color:blue", 0, 0, `no item has color "blue"`},
+		{"color:red:taste:sour", 0, 0, "every term has items, but no item has all of them"},
+		{"color", 0, 0, "the query is not a list of field:value pairs"},
+	}
+	for _, c := range cases {
+		p := ds.Explain(c.query)
+		if p.Actual != c.actual || p.Matching != c.matching || p.Reason != c.reason {
+			t.Errorf("Explain(%q): expected actual %d, matching %d and reason %q, got\n%s", c.query, c.actual, c.matching, c.reason, p)
+		}
+	}
+
+	p := ds.Explain("taste:sweet:color:yellow")
+	if len(p.Terms) != 2 || p.Terms[0].Field != "taste" || p.Terms[0].Items != 2 || p.Terms[1].Items != 1 {
+		t.Errorf("Unexpected terms %+v", p.Terms)
+	}
+	if strings.Join(p.Order, ",") != "color:yellow,taste:sweet" {
+		t.Errorf("Expected the smaller posting list first, got %v", p.Order)
+	}
+	if p.Composite || p.Estimated != 1 {
+		t.Errorf("Expected no composite key and an estimate of 1, got %t and %d", p.Composite, p.Estimated)
+	}
+}
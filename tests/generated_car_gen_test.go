@@ -0,0 +1,124 @@
+// Code generated by matrixsearch-gen. DO NOT EDIT.
+
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CarIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func CarIndexer(v Car) []string {
+	return appendCarKeys(nil, "", nil, v)
+}
+
+// CarQueryBuilder builds queries against the keys produced by CarIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type CarQueryBuilder struct {
+	terms [10][]string
+}
+
+// CarQuery returns an empty query builder for Car.
+func CarQuery() *CarQueryBuilder {
+	return &CarQueryBuilder{}
+}
+
+func (q *CarQueryBuilder) Model(v string) *CarQueryBuilder {
+	q.terms[0] = append(q.terms[0], "model:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Brand(v string) *CarQueryBuilder {
+	q.terms[1] = append(q.terms[1], "brand:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Year(v int) *CarQueryBuilder {
+	q.terms[2] = append(q.terms[2], "year:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+func (q *CarQueryBuilder) Color(v string) *CarQueryBuilder {
+	q.terms[3] = append(q.terms[3], "color:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Type(v string) *CarQueryBuilder {
+	q.terms[4] = append(q.terms[4], "type:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Horsepower(v int) *CarQueryBuilder {
+	q.terms[5] = append(q.terms[5], "horsepower:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+func (q *CarQueryBuilder) Capacity(v float64) *CarQueryBuilder {
+	q.terms[6] = append(q.terms[6], "capacity:"+strconv.FormatFloat(v, 'f', -1, 64))
+	return q
+}
+
+func (q *CarQueryBuilder) Name(v string) *CarQueryBuilder {
+	q.terms[7] = append(q.terms[7], "name:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Country(v string) *CarQueryBuilder {
+	q.terms[8] = append(q.terms[8], "country:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *CarQueryBuilder) Price(v float64) *CarQueryBuilder {
+	q.terms[9] = append(q.terms[9], "price:"+strconv.FormatFloat(v, 'f', -1, 64))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *CarQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendCarKeys(keys []string, prefix string, path []any, v Car) []string {
+	if v.Model != "" {
+		keys = append(keys, prefix+"model:"+v.Model)
+	}
+	if v.Brand != "" {
+		keys = append(keys, prefix+"brand:"+v.Brand)
+	}
+	keys = append(keys, prefix+"year:"+strconv.FormatInt(int64(v.Year), 10))
+	if v.Color != "" {
+		keys = append(keys, prefix+"color:"+v.Color)
+	}
+	keys = appendCarEngineKeys(keys, prefix, path, v.Engine)
+	keys = appendCarManufacturerKeys(keys, prefix, path, v.Manufacturer)
+	keys = append(keys, prefix+"price:"+strconv.FormatFloat(v.Price, 'f', -1, 64))
+	if v.Previous != nil && !slices.Contains(path, any(v.Previous)) {
+		keys = appendCarKeys(keys, prefix+"previous.", append(path, v.Previous), *v.Previous)
+	}
+	return keys
+}
+
+func appendCarEngineKeys(keys []string, prefix string, path []any, v Engine) []string {
+	if v.Type != "" {
+		keys = append(keys, prefix+"type:"+v.Type)
+	}
+	keys = append(keys, prefix+"horsepower:"+strconv.FormatInt(int64(v.Horsepower), 10))
+	keys = append(keys, prefix+"capacity:"+strconv.FormatFloat(v.Capacity, 'f', -1, 64))
+	return keys
+}
+
+func appendCarManufacturerKeys(keys []string, prefix string, path []any, v Manufacturer) []string {
+	if v.Name != "" {
+		keys = append(keys, prefix+"name:"+v.Name)
+	}
+	if v.Country != "" {
+		keys = append(keys, prefix+"country:"+v.Country)
+	}
+	return keys
+}
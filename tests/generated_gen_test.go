@@ -0,0 +1,435 @@
+// Code generated by matrixsearch-gen. DO NOT EDIT.
+
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListingIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func ListingIndexer(v Listing) []string {
+	return appendListingKeys(nil, "", nil, v)
+}
+
+// ListingID returns the ID of v.
+func ListingID(v Listing) string {
+	return v.ID
+}
+
+// ListingQueryBuilder builds queries against the keys produced by ListingIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type ListingQueryBuilder struct {
+	terms [7][]string
+}
+
+// ListingQuery returns an empty query builder for Listing.
+func ListingQuery() *ListingQueryBuilder {
+	return &ListingQueryBuilder{}
+}
+
+func (q *ListingQueryBuilder) ID(v string) *ListingQueryBuilder {
+	q.terms[0] = append(q.terms[0], "id:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *ListingQueryBuilder) SellerName(v string) *ListingQueryBuilder {
+	q.terms[1] = append(q.terms[1], "seller.name:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *ListingQueryBuilder) SellerCountry(v string) *ListingQueryBuilder {
+	q.terms[2] = append(q.terms[2], "seller.country:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *ListingQueryBuilder) Type(v string) *ListingQueryBuilder {
+	q.terms[3] = append(q.terms[3], "type:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *ListingQueryBuilder) Horsepower(v int) *ListingQueryBuilder {
+	q.terms[4] = append(q.terms[4], "horsepower:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+func (q *ListingQueryBuilder) Capacity(v float64) *ListingQueryBuilder {
+	q.terms[5] = append(q.terms[5], "capacity:"+strconv.FormatFloat(v, 'f', -1, 64))
+	return q
+}
+
+func (q *ListingQueryBuilder) Rating(v int) *ListingQueryBuilder {
+	q.terms[6] = append(q.terms[6], "rating:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *ListingQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendListingKeys(keys []string, prefix string, path []any, v Listing) []string {
+	if v.ID != "" {
+		keys = append(keys, prefix+"id:"+v.ID)
+	}
+	if v.Seller != nil && !slices.Contains(path, any(v.Seller)) {
+		keys = appendListingManufacturerKeys(keys, prefix+"seller.", append(path, v.Seller), *v.Seller)
+	}
+	if v.Engine != nil && !slices.Contains(path, any(v.Engine)) {
+		keys = appendListingEngineKeys(keys, prefix, append(path, v.Engine), *v.Engine)
+	}
+	if v.Rating != nil {
+		keys = append(keys, prefix+"rating:"+strconv.FormatInt(int64(*v.Rating), 10))
+	}
+	return keys
+}
+
+func appendListingManufacturerKeys(keys []string, prefix string, path []any, v Manufacturer) []string {
+	if v.Name != "" {
+		keys = append(keys, prefix+"name:"+v.Name)
+	}
+	if v.Country != "" {
+		keys = append(keys, prefix+"country:"+v.Country)
+	}
+	return keys
+}
+
+func appendListingEngineKeys(keys []string, prefix string, path []any, v Engine) []string {
+	if v.Type != "" {
+		keys = append(keys, prefix+"type:"+v.Type)
+	}
+	keys = append(keys, prefix+"horsepower:"+strconv.FormatInt(int64(v.Horsepower), 10))
+	keys = append(keys, prefix+"capacity:"+strconv.FormatFloat(v.Capacity, 'f', -1, 64))
+	return keys
+}
+
+// PoolIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func PoolIndexer(v Pool) []string {
+	return appendPoolKeys(nil, "", nil, v)
+}
+
+// PoolID returns the ID of v.
+func PoolID(v Pool) string {
+	return v.ID
+}
+
+// PoolQueryBuilder builds queries against the keys produced by PoolIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type PoolQueryBuilder struct {
+	terms [4][]string
+}
+
+// PoolQuery returns an empty query builder for Pool.
+func PoolQuery() *PoolQueryBuilder {
+	return &PoolQueryBuilder{}
+}
+
+func (q *PoolQueryBuilder) ID(v string) *PoolQueryBuilder {
+	q.terms[0] = append(q.terms[0], "id:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *PoolQueryBuilder) Tags(v string) *PoolQueryBuilder {
+	q.terms[1] = append(q.terms[1], "tags:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *PoolQueryBuilder) Ports(v int) *PoolQueryBuilder {
+	q.terms[2] = append(q.terms[2], "port:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+func (q *PoolQueryBuilder) Labels(key string, v string) *PoolQueryBuilder {
+	q.terms[3] = append(q.terms[3], "labels."+matrixsearch.Escape(key)+":"+matrixsearch.Escape(v))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *PoolQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendPoolKeys(keys []string, prefix string, path []any, v Pool) []string {
+	if v.ID != "" {
+		keys = append(keys, prefix+"id:"+v.ID)
+	}
+	if len(v.Tags) > 0 {
+		seen0 := make(map[string]bool, len(v.Tags))
+		for _, e0 := range v.Tags {
+			if e0 != "" {
+				if k := prefix + "tags:" + e0; !seen0[k] {
+					seen0[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	if len(v.Ports) > 0 {
+		seen0 := make(map[string]bool, len(v.Ports))
+		for _, e0 := range v.Ports {
+			if k := prefix + "port:" + strconv.FormatInt(int64(e0), 10); !seen0[k] {
+				seen0[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	if len(v.Labels) > 0 {
+		names0 := make([]string, 0, len(v.Labels))
+		entries0 := make(map[string]string, len(v.Labels))
+		for k0, e0 := range v.Labels {
+			name, s := k0, e0
+			if name != "" && s != "" {
+				entries0[name] = s
+				names0 = append(names0, name)
+			}
+		}
+		sort.Strings(names0)
+		for _, name := range names0 {
+			keys = append(keys, prefix+"labels."+matrixsearch.Escape(name)+":"+entries0[name])
+		}
+	}
+	return keys
+}
+
+// SiteIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func SiteIndexer(v Site) []string {
+	return appendSiteKeys(nil, "", nil, v)
+}
+
+// SiteID returns the ID of v.
+func SiteID(v Site) string {
+	return v.ID
+}
+
+// SiteQueryBuilder builds queries against the keys produced by SiteIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type SiteQueryBuilder struct {
+	terms [5][]string
+}
+
+// SiteQuery returns an empty query builder for Site.
+func SiteQuery() *SiteQueryBuilder {
+	return &SiteQueryBuilder{}
+}
+
+func (q *SiteQueryBuilder) ID(v string) *SiteQueryBuilder {
+	q.terms[0] = append(q.terms[0], "id:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *SiteQueryBuilder) Country(v string) *SiteQueryBuilder {
+	q.terms[1] = append(q.terms[1], "country:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *SiteQueryBuilder) City(v string) *SiteQueryBuilder {
+	q.terms[2] = append(q.terms[2], "city:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *SiteQueryBuilder) Name(v string) *SiteQueryBuilder {
+	q.terms[3] = append(q.terms[3], "name:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *SiteQueryBuilder) Labels(key string, v string) *SiteQueryBuilder {
+	q.terms[4] = append(q.terms[4], "labels."+matrixsearch.Escape(key)+":"+matrixsearch.Escape(v))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *SiteQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendSiteKeys(keys []string, prefix string, path []any, v Site) []string {
+	if v.ID != "" {
+		keys = append(keys, prefix+"id:"+v.ID)
+	}
+	if s := matrixsearch.Lower(v.Country); s != "" {
+		keys = append(keys, prefix+"country:"+s)
+	}
+	if s := matrixsearch.Trim(matrixsearch.Fold(v.City)); s != "" {
+		keys = append(keys, prefix+"city:"+s)
+	}
+	if s := matrixsearch.NFC(v.Name); s != "" {
+		keys = append(keys, prefix+"name:"+s)
+	}
+	if len(v.Labels) > 0 {
+		names0 := make([]string, 0, len(v.Labels))
+		entries0 := make(map[string]string, len(v.Labels))
+		for k0, e0 := range v.Labels {
+			name, s := k0, matrixsearch.Upper(e0)
+			if name != "" && s != "" {
+				entries0[name] = s
+				names0 = append(names0, name)
+			}
+		}
+		sort.Strings(names0)
+		for _, name := range names0 {
+			keys = append(keys, prefix+"labels."+matrixsearch.Escape(name)+":"+entries0[name])
+		}
+	}
+	return keys
+}
+
+// ProbeIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func ProbeIndexer(v Probe) []string {
+	return appendProbeKeys(nil, "", nil, v)
+}
+
+// ProbeID returns the ID of v.
+func ProbeID(v Probe) string {
+	return v.ID
+}
+
+// ProbeQueryBuilder builds queries against the keys produced by ProbeIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type ProbeQueryBuilder struct {
+	terms [4][]string
+}
+
+// ProbeQuery returns an empty query builder for Probe.
+func ProbeQuery() *ProbeQueryBuilder {
+	return &ProbeQueryBuilder{}
+}
+
+func (q *ProbeQueryBuilder) ID(v string) *ProbeQueryBuilder {
+	q.terms[0] = append(q.terms[0], "id:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *ProbeQueryBuilder) LastSeen(v time.Time) *ProbeQueryBuilder {
+	q.terms[1] = append(q.terms[1], "lastseen:"+strconv.FormatInt(v.Unix(), 10))
+	return q
+}
+
+func (q *ProbeQueryBuilder) Checked(v time.Time) *ProbeQueryBuilder {
+	q.terms[2] = append(q.terms[2], "checked:"+strconv.FormatInt(v.Unix(), 10))
+	return q
+}
+
+func (q *ProbeQueryBuilder) Latency(v time.Duration) *ProbeQueryBuilder {
+	q.terms[3] = append(q.terms[3], "latency:"+strconv.FormatFloat(v.Seconds(), 'f', -1, 64))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *ProbeQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendProbeKeys(keys []string, prefix string, path []any, v Probe) []string {
+	if v.ID != "" {
+		keys = append(keys, prefix+"id:"+v.ID)
+	}
+	if !v.LastSeen.IsZero() {
+		keys = append(keys, prefix+"lastseen:"+strconv.FormatInt(v.LastSeen.Unix(), 10))
+		utc := v.LastSeen.UTC()
+		keys = append(keys, prefix+"lastseen.day:"+utc.Format("2006-01-02"))
+		keys = append(keys, prefix+"lastseen.hour:"+utc.Format("2006-01-02T15"))
+	}
+	if v.Checked != nil {
+		if !(*v.Checked).IsZero() {
+			keys = append(keys, prefix+"checked:"+strconv.FormatInt((*v.Checked).Unix(), 10))
+		}
+	}
+	keys = append(keys, prefix+"latency:"+strconv.FormatFloat(v.Latency.Seconds(), 'f', -1, 64))
+	return keys
+}
+
+// LinkIndexer returns the keys matrixsearch.AutoIndexer builds for v, without reflection.
+func LinkIndexer(v Link) []string {
+	return appendLinkKeys(nil, "", nil, v)
+}
+
+// LinkID returns the ID of v.
+func LinkID(v Link) string {
+	return v.ID
+}
+
+// LinkQueryBuilder builds queries against the keys produced by LinkIndexer. Terms are emitted in
+// indexer order, whatever order the methods are called in.
+type LinkQueryBuilder struct {
+	terms [6][]string
+}
+
+// LinkQuery returns an empty query builder for Link.
+func LinkQuery() *LinkQueryBuilder {
+	return &LinkQueryBuilder{}
+}
+
+func (q *LinkQueryBuilder) ID(v string) *LinkQueryBuilder {
+	q.terms[0] = append(q.terms[0], "id:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *LinkQueryBuilder) Speed(v int) *LinkQueryBuilder {
+	q.terms[1] = append(q.terms[1], "speed:"+strconv.FormatInt(int64(v), 10))
+	return q
+}
+
+func (q *LinkQueryBuilder) SpeedBucket(v string) *LinkQueryBuilder {
+	q.terms[2] = append(q.terms[2], "speed.bucket:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *LinkQueryBuilder) Speedtype(v string) *LinkQueryBuilder {
+	q.terms[3] = append(q.terms[3], "speedtype:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *LinkQueryBuilder) PriceBucket(v string) *LinkQueryBuilder {
+	q.terms[4] = append(q.terms[4], "price.bucket:"+matrixsearch.Escape(v))
+	return q
+}
+
+func (q *LinkQueryBuilder) LatencyBucket(v string) *LinkQueryBuilder {
+	q.terms[5] = append(q.terms[5], "latency.bucket:"+matrixsearch.Escape(v))
+	return q
+}
+
+// String returns the query in the form accepted by DataStore.Search.
+func (q *LinkQueryBuilder) String() string {
+	var parts []string
+	for _, t := range q.terms {
+		parts = append(parts, t...)
+	}
+	return strings.Join(parts, ":")
+}
+
+func appendLinkKeys(keys []string, prefix string, path []any, v Link) []string {
+	if v.ID != "" {
+		keys = append(keys, prefix+"id:"+v.ID)
+	}
+	keys = append(keys, prefix+"speed:"+strconv.FormatInt(int64(v.Speed), 10))
+	keys = append(keys, prefix+"speed.bucket:"+matrixsearch.Bucket(float64(v.Speed), 0, 75, 150))
+	for _, s := range matrixsearch.Extract("speedtype", v.Speed) {
+		keys = append(keys, prefix+"speedtype:"+s)
+	}
+	if v.Price != nil {
+		keys = append(keys, prefix+"price.bucket:"+matrixsearch.StepBucket(*v.Price, 5))
+	}
+	keys = append(keys, prefix+"latency.bucket:"+matrixsearch.Bucket(v.Latency.Seconds(), 0, 0.1, 1))
+	return keys
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"testing"
+)
+
+//go:generate go run ../cmd/matrixsearch-gen -type=Listing,Pool,Site,Probe,Link -id=ID -output=generated_gen_test.go
+//go:generate go run ../cmd/matrixsearch-gen -type=Car -output=generated_car_gen_test.go
+
+func TestGeneratedIndexerMatchesAutoIndexer(t *testing.T) {
+	rating := 4
+	listings := []Listing{
+		{ID: "l1"},
+		{ID: "l2", Seller: &Manufacturer{Name: "Tesla Inc.", Country: "US"}, Engine: &Engine{Type: "Electric", Capacity: 1.5}, Rating: &rating, Notes: "skip"},
+	}
+	for _, l := range listings {
+		if got, want := ListingIndexer(l), matrixsearch.AutoIndexer(l); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected generated keys %v to match AutoIndexer keys %v", got, want)
+		}
+		if ListingID(l) != l.ID {
+			t.Errorf("Expected ListingID to return %s, got %s", l.ID, ListingID(l))
+		}
+	}
+}
+
+func TestGeneratedQueryBuilder(t *testing.T) {
+	ds := matrixsearch.NewDataStore(ListingID, ListingIndexer)
+	rating := 5
+	ds.Insert(Listing{ID: "l1", Seller: &Manufacturer{Name: "Tesla Inc.", Country: "US"}, Rating: &rating})
+	ds.Insert(Listing{ID: "l2", Seller: &Manufacturer{Name: "BMW Group", Country: "Germany"}, Rating: &rating})
+	q := ListingQuery().Rating(5).SellerCountry("US")
+	if got, want := q.String(), "seller.country:US:rating:5"; got != want {
+		t.Errorf("Expected query %q, got %q", want, got)
+	}
+	if results := ds.Search(q.String()); len(results) != 1 || results[0].ID != "l1" {
+		t.Errorf("Expected only l1 to match, got %v", results)
+	}
+}
+
+func TestGeneratedCollections(t *testing.T) {
+	p := Pool{
+		ID:     "p1",
+		Tags:   []string{"residential", "rotating"},
+		Ports:  [2]int{80, 443},
+		Labels: map[string]string{"region": "eu", "env": "prod"},
+	}
+	if got, want := PoolIndexer(p), matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %v to match AutoIndexer keys %v", got, want)
+	}
+	q := PoolQuery().Labels("env", "prod").Tags("residential").Tags("rotating")
+	if got, want := q.String(), "tags:residential:tags:rotating:labels.env:prod"; got != want {
+		t.Errorf("Expected query %q, got %q", want, got)
+	}
+}
+
+func TestGeneratedRepeatsAndCycles(t *testing.T) {
+	p := Pool{ID: "p1", Tags: []string{"a", "b", "a"}, Ports: [2]int{80, 80}}
+	if got, want := PoolIndexer(p), matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %v to match AutoIndexer keys %v", got, want)
+	}
+
+	loop := &Car{Model: "a"}
+	loop.Previous = loop
+	ring := &Car{Model: "a", Previous: &Car{Model: "b"}}
+	ring.Previous.Previous = ring
+	chain := Car{Model: "a", Previous: &Car{Model: "b", Previous: &Car{Model: "c"}}}
+	for _, c := range []Car{*loop, *ring, chain} {
+		if got, want := CarIndexer(c), matrixsearch.AutoIndexer(c); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected generated keys %v to match AutoIndexer keys %v", got, want)
+		}
+	}
+}
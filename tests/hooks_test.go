@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/xvertile/matrixsearch"
+	"github.com/xvertile/matrixsearch/hooks"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingHooks struct {
+	matrixsearch.NopHooks
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHooks) record(e string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, e)
+}
+
+func (h *recordingHooks) OnInsert(id string) { h.record("insert " + id) }
+func (h *recordingHooks) OnDelete(id string) { h.record("delete " + id) }
+func (h *recordingHooks) OnSearch(query string, hits int, dur time.Duration) {
+	h.record("search " + query + " " + strconv.Itoa(hits))
+}
+func (h *recordingHooks) OnError(op string, err error) { h.record("error " + op) }
+
+func (h *recordingHooks) take() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := h.events
+	h.events = nil
+	return events
+}
+
+func TestHooks(t *testing.T) {
+	h := &recordingHooks{}
+	ds := matrixsearch.NewDataStore(func(f Fruit) string { return f.Name }, func(f Fruit) []string {
+		return []string{"color:" + f.Color}
+	}, matrixsearch.WithHooks(h))
+	ds.Insert(Fruit{Name: "apple", Color: "red"})
+	ds.Update(Fruit{Name: "apple", Color: "green"})
+	ds.InsertMany([]Fruit{{Name: "lemon", Color: "yellow"}, {Name: "lime", Color: "green"}})
+	ds.Search("color:green")
+	ds.SearchRandom("color:blue")
+	ds.DeleteMany([]Fruit{{Name: "lemon"}, {Name: "kiwi"}})
+	ds.DeleteByID("lime")
+	want := []string{
+		"insert apple", "insert apple", "insert lemon", "insert lime",
+		"search color:green 2", "search color:blue 0",
+		"delete lemon", "delete lime",
+	}
+	if got := h.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+
+	ds.Txn(func(tx *matrixsearch.Txn[Fruit]) error {
+		tx.Insert(Fruit{Name: "plum", Color: "purple"})
+		return errors.New("abort")
+	})
+	if got := h.take(); len(got) != 0 {
+		t.Errorf("Expected a rolled back transaction to report nothing, got %v", got)
+	}
+
+	if _, err := ds.Query(matrixsearch.Q().Eq("taste", "sweet")); !errors.Is(err, matrixsearch.ErrUnknownField) {
+		t.Fatalf("Expected ErrUnknownField, got %v", err)
+	}
+	if got, want := h.take(), []string{"search taste=sweet 0", "error query"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected events %v, got %v", want, got)
+	}
+}
+
+type reentrantHooks struct {
+	matrixsearch.NopHooks
+	ds     *matrixsearch.DataStore[Fruit]
+	counts []int
+}
+
+func (h *reentrantHooks) OnInsert(id string) { h.counts = append(h.counts, h.ds.Count()) }
+
+func TestHooksRunOutsideLock(t *testing.T) {
+	h := &reentrantHooks{}
+	h.ds = matrixsearch.NewDataStore(func(f Fruit) string { return f.Name }, func(f Fruit) []string {
+		return []string{"color:" + f.Color}
+	}, matrixsearch.WithHooks(h))
+	h.ds.Insert(Fruit{Name: "apple", Color: "red"})
+	h.ds.Insert(Fruit{Name: "lemon", Color: "yellow"})
+	if !reflect.DeepEqual(h.counts, []int{1, 2}) {
+		t.Errorf("Expected hooks to see counts [1 2], got %v", h.counts)
+	}
+}
+
+type shardedReentrantHooks struct {
+	matrixsearch.NopHooks
+	ds     *matrixsearch.ShardedDataStore[Fruit]
+	events []string
+}
+
+// OnInsert reads the store and, for each original fruit, writes a copy back into it.
+func (h *shardedReentrantHooks) OnInsert(id string) {
+	h.events = append(h.events, id+" "+strconv.Itoa(h.ds.Count()))
+	if !strings.HasSuffix(id, "-copy") {
+		h.ds.Insert(Fruit{Name: id + "-copy", Color: "grey"})
+	}
+}
+
+func TestShardedTxnHooksRunOutsideLock(t *testing.T) {
+	h := &shardedReentrantHooks{}
+	h.ds = matrixsearch.NewShardedDataStore(4, func(f Fruit) string { return f.Name }, func(f Fruit) []string {
+		return []string{"color:" + f.Color}
+	}, matrixsearch.WithHooks(h))
+	done := make(chan error)
+	go func() {
+		done <- h.ds.Txn(func(tx *matrixsearch.Txn[Fruit]) error {
+			for _, name := range []string{"apple", "lemon", "plum", "kiwi"} {
+				tx.Insert(Fruit{Name: name, Color: "red"})
+			}
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the hooks to run after every shard is unlocked")
+	}
+	want := []string{
+		"apple 4", "apple-copy 5", "lemon 5", "lemon-copy 6",
+		"plum 6", "plum-copy 7", "kiwi 7", "kiwi-copy 8",
+	}
+	if !reflect.DeepEqual(h.events, want) {
+		t.Errorf("Expected the inserts in write order %v, got %v", want, h.events)
+	}
+}
+
+func TestShardedHooksSearchOnce(t *testing.T) {
+	h := &recordingHooks{}
+	ds := matrixsearch.NewShardedDataStore(4, getProxyID, indexProxy, matrixsearch.WithHooks(h))
+	for i := 0; i < 20; i++ {
+		p := randomProxy(i)
+		p.Geo.Country = "us"
+		ds.Insert(p)
+	}
+	h.take()
+	ds.SearchRandom("country:us")
+	if got := h.take(); !reflect.DeepEqual(got, []string{"search country:us 1"}) {
+		t.Errorf("Expected one search event, got %v", got)
+	}
+}
+
+func TestHooksTracing(t *testing.T) {
+	exp := hooks.NewInMemoryExporter()
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithHooks(hooks.Tracing(exp)))
+	p := randomProxy(1)
+	ds.Insert(p)
+	ds.Search("country:" + p.Geo.Country)
+	spans := exp.Spans()
+	if len(spans) != 2 || spans[0].Name != "matrixsearch.insert" || spans[1].Name != "matrixsearch.search" {
+		t.Fatalf("Expected insert and search spans, got %+v", spans)
+	}
+	s := spans[1]
+	if s.Attributes["db.statement"] != "country:"+p.Geo.Country || s.Attributes["matrixsearch.hits"] != 1 {
+		t.Errorf("Unexpected search span attributes %v", s.Attributes)
+	}
+	if fn, _ := s.Attributes["code.function"].(string); !strings.HasSuffix(fn, "TestHooksTracing") {
+		t.Errorf("Expected the span to name the calling test, got %q", fn)
+	}
+	if s.End.Before(s.Start) {
+		t.Error("Expected the span to end after it starts")
+	}
+	exp.Reset()
+	ds.DumpTo(&bytes.Buffer{}, "pdf")
+	if spans := exp.Spans(); len(spans) != 1 || spans[0].Name != "matrixsearch.dump" || spans[0].Err == nil {
+		t.Errorf("Expected a failed dump span, got %+v", spans)
+	}
+}
+
+func TestHooksSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithHooks(hooks.Slog(logger, time.Nanosecond)))
+	ds.Insert(randomProxy(1))
+	ds.Search("country:nowhere")
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single slow search record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "matrixsearch slow search" || record["query"] != "country:nowhere" || record["hits"] != 0.0 {
+		t.Errorf("Unexpected record %v", record)
+	}
+	if caller, _ := record["caller"].(string); !strings.HasSuffix(caller, "TestHooksSlog") {
+		t.Errorf("Expected the record to name the calling test, got %q", caller)
+	}
+}
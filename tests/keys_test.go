@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"testing"
+)
+
+type Endpoint struct {
+	ID       string `text:"id"`
+	Host     string `text:"host"`
+	Port     string `text:"port"`
+	Timezone string `text:"timezone"`
+}
+
+func endpointStore(opts ...matrixsearch.Option) *matrixsearch.DataStore[Endpoint] {
+	ds := matrixsearch.NewDataStore(func(e Endpoint) string { return e.ID }, func(e Endpoint) []string {
+		return []string{"host:" + e.Host, "port:" + e.Port}
+	}, opts...)
+	ds.Insert(Endpoint{ID: "1", Host: "2001:db8::1"})
+	ds.Insert(Endpoint{ID: "2", Host: "2001", Port: "db8::1"})
+	ds.Insert(Endpoint{ID: "3", Host: "a:port:b"})
+	ds.Insert(Endpoint{ID: "4", Host: "a", Port: "b"})
+	return ds
+}
+
+func TestKeyEscapingAvoidsFalseMatches(t *testing.T) {
+	ds := endpointStore()
+	if got := ds.Search("host:a:port:b"); len(got) != 1 || got[0].ID != "4" {
+		t.Errorf("Expected only endpoint 4 for an unescaped query, got %v", got)
+	}
+	if got := ds.Search("host:" + matrixsearch.Escape("a:port:b")); len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("Expected only endpoint 3 for an escaped query, got %v", got)
+	}
+	if got := ds.Search("host:" + matrixsearch.Escape("2001:db8::1")); len(got) != 1 || got[0].ID != "1" {
+		t.Errorf("Expected only endpoint 1, got %v", got)
+	}
+	got, err := ds.Query(matrixsearch.Q().Eq("host", "2001").Eq("port", "db8::1"))
+	if err != nil || len(got) != 1 || got[0].ID != "2" {
+		t.Errorf("Expected only endpoint 2 from Query, got %v %v", got, err)
+	}
+	keys, _ := ds.Compile(matrixsearch.Q().In("host", "a:port:b"))
+	if len(keys) != 1 || keys[0] != `host:a\:port\:b` {
+		t.Errorf("Expected escaped key, got %v", keys)
+	}
+}
+
+func TestWithSeparator(t *testing.T) {
+	ds := endpointStore(matrixsearch.WithSeparator("/"))
+	if got := ds.Search("host/2001:db8::1"); len(got) != 1 || got[0].ID != "1" {
+		t.Errorf("Expected endpoint 1, got %v", got)
+	}
+	if got := ds.Search("host/2001/port/db8::1"); len(got) != 1 || got[0].ID != "2" {
+		t.Errorf("Expected endpoint 2, got %v", got)
+	}
+	if _, ok := ds.SearchRandom("host/a/port/b"); !ok {
+		t.Error("Expected SearchRandom to find endpoint 4")
+	}
+	if got := ds.Snapshot().Search("host/a:port:b"); len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("Expected snapshot search to use the separator, got %v", got)
+	}
+}
+
+func TestAutoIndexerTimezone(t *testing.T) {
+	ds := matrixsearch.NewDataStore(func(e Endpoint) string { return e.ID }, matrixsearch.AutoIndexer[Endpoint])
+	ds.Insert(Endpoint{ID: "1", Timezone: "UTC+05:30"})
+	ds.Insert(Endpoint{ID: "2", Timezone: "UTC+05"})
+	if got := ds.Search("timezone:" + matrixsearch.Escape("UTC+05:30")); len(got) != 1 || got[0].ID != "1" {
+		t.Errorf("Expected endpoint 1, got %v", got)
+	}
+}
+
+func TestAutoIndexerMapKeyEscaping(t *testing.T) {
+	p := Pool{ID: "p1", Labels: map[string]string{"a:b": "x", "c/d": "y"}}
+	want := []string{"id:p1", "port:0", `labels.a\:b:x`, "labels.c/d:y"}
+	if got := matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+	if got := PoolIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %v, got %v", want, got)
+	}
+
+	for _, sep := range []string{":", "/"} {
+		ds := matrixsearch.NewDataStore(func(p Pool) string { return p.ID }, matrixsearch.AutoIndexer[Pool], matrixsearch.WithSeparator(sep))
+		ds.Insert(p)
+		for field, value := range map[string]string{"labels.a:b": "x", "labels.c/d": "y"} {
+			if got, err := ds.Query(matrixsearch.Q().Eq(field, value)); err != nil || len(got) != 1 {
+				t.Errorf("Expected Query on %s to find the pool with separator %q, got %v, %v", field, sep, got, err)
+			}
+		}
+	}
+	ds := matrixsearch.NewDataStore(func(p Pool) string { return p.ID }, matrixsearch.AutoIndexer[Pool], matrixsearch.WithSeparator("/"))
+	ds.Insert(p)
+	if got := ds.Search(`labels.c\/d/y`); len(got) != 1 {
+		t.Errorf("Expected an escaped separator in the field to match, got %v", got)
+	}
+	if got := ds.Search(`labels.a:b/x`); len(got) != 1 {
+		t.Errorf("Expected a ':' in the field to match, got %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"github.com/xvertile/matrixsearch/metrics"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	ds := metrics.Instrument(reg, "proxies", matrixsearch.NewDataStore(getProxyID, indexProxy))
+	p := randomProxy(1)
+	ds.Insert(p)
+	ds.Insert(randomProxy(2))
+	ds.Update(p)
+	ds.Search("country:" + p.Geo.Country)
+	ds.Search("country:nowhere")
+	ds.SearchRandom("country:nowhere")
+	ds.Delete(p)
+	if ds.Count() != 1 {
+		t.Fatalf("Expected 1 item, got %d", ds.Count())
+	}
+	others := []Proxy{randomProxy(3), randomProxy(4)}
+	ds.InsertMany(others)
+	ds.DeleteMany(others)
+	ds.ApplyBatch([]matrixsearch.Op[Proxy]{matrixsearch.InsertOp(p)})
+	ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error { return nil })
+	ds.CompareAndSwap(p.ID, 0, p)
+	ds.Query(matrixsearch.Q().Eq("country", p.Geo.Country))
+	ds.QueryRandom(matrixsearch.Q().Eq("country", "nowhere"))
+	ds.Query(matrixsearch.Q().Eq("contry", "us"))
+
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+	for _, want := range []string{
+		"# TYPE matrixsearch_items gauge\n",
+		`matrixsearch_items{store="proxies"} 2` + "\n",
+		"# TYPE matrixsearch_operation_duration_seconds histogram\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="insert"} 2` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="update"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_bucket{store="proxies",op="search",le="+Inf"} 2` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="search",result="hit"} 1` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="search",result="miss"} 1` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="search_random",result="miss"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="insert_many"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="delete_many"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="apply_batch"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="txn"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="compare_and_swap"} 1` + "\n",
+		`matrixsearch_operation_duration_seconds_count{store="proxies",op="query"} 2` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="query",result="hit"} 1` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="query",result="miss"} 0` + "\n",
+		`matrixsearch_search_results_total{store="proxies",op="query_random",result="miss"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected metrics to contain %q, got\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, `matrixsearch_keys{store="proxies"} `) {
+		t.Error("Expected a key count gauge")
+	}
+	if strings.Contains(out, "matrixsearch_memory_bytes") {
+		t.Error("Expected no memory gauge without full stats")
+	}
+}
+
+func TestMetricsFullStats(t *testing.T) {
+	reg := metrics.NewRegistry()
+	ds := metrics.Instrument(reg, "proxies", matrixsearch.NewDataStore(getProxyID, indexProxy), metrics.WithFullStats())
+	ds.Insert(randomProxy(1))
+	var b strings.Builder
+	reg.WriteTo(&b)
+	keys := `matrixsearch_keys{store="proxies"} ` + strconv.Itoa(ds.Stats().Keys) + "\n"
+	if out := b.String(); !strings.Contains(out, keys) || !strings.Contains(out, `matrixsearch_memory_bytes{store="proxies"} `) {
+		t.Errorf("Expected the key count and memory gauges, got\n%s", out)
+	}
+}
+
+func TestMetricsDuplicateStore(t *testing.T) {
+	reg := metrics.NewRegistry()
+	metrics.Instrument(reg, "proxies", matrixsearch.NewDataStore(getProxyID, indexProxy))
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a store name twice to panic")
+		}
+	}()
+	metrics.Instrument(reg, "proxies", matrixsearch.NewDataStore(getProxyID, indexProxy))
+}
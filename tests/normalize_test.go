@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"testing"
+)
+
+type Site struct {
+	ID      string            `text:"id"`
+	Country string            `text:"country,lower"`
+	City    string            `text:"city,fold,trim"`
+	Name    string            `text:"name,nfc"`
+	Labels  map[string]string `text:"labels,upper"`
+}
+
+func TestAutoIndexerNormalizers(t *testing.T) {
+	s := Site{ID: "1", Country: "US", City: " Straße ", Name: "Café", Labels: map[string]string{"env": "prod"}}
+	want := []string{"id:1", "country:us", "city:strasse", "name:Café", "labels.env:PROD"}
+	if got := matrixsearch.AutoIndexer(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %q, got %q", want, got)
+	}
+	if got := SiteIndexer(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %q, got %q", want, got)
+	}
+}
+
+func TestNormalizedSearch(t *testing.T) {
+	ds := matrixsearch.NewDataStore(func(s Site) string { return s.ID }, matrixsearch.AutoIndexer[Site])
+	ds.Insert(Site{ID: "1", Country: "US", City: "Berlin"})
+	ds.Insert(Site{ID: "2", Country: "us", City: "berlin "})
+	ds.Insert(Site{ID: "3", Country: "Us", City: "Paris"})
+	if got := len(ds.Search("country:US")); got != 3 {
+		t.Errorf("Expected 3 sites for country:US, got %d", got)
+	}
+	if got := len(ds.Search("country:uS:city:BERLIN")); got != 2 {
+		t.Errorf("Expected 2 sites in Berlin, got %d", got)
+	}
+	got, err := ds.Query(matrixsearch.Q().Eq("city", " PARIS"))
+	if err != nil || len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("Expected site 3 from Query, got %v %v", got, err)
+	}
+	if got := len(ds.Search("labels.env:prod")); got != 0 {
+		t.Errorf("Expected no sites with labels, got %d", got)
+	}
+}
+
+func TestWithNormalizerCustomIndexer(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithNormalizer("country", matrixsearch.Upper))
+	p := randomProxy(1)
+	p.Geo.Country = "us"
+	ds.Insert(p)
+	if got := len(ds.Search("country:Us")); got != 1 {
+		t.Errorf("Expected the custom indexer's keys to be normalized, got %d results", got)
+	}
+	keys, _ := ds.Compile(matrixsearch.Q().Eq("country", "us"))
+	if !reflect.DeepEqual(keys, []string{"country:US"}) {
+		t.Errorf("Expected normalized query keys, got %v", keys)
+	}
+}
+
+func TestWithNormalizerOverridesTags(t *testing.T) {
+	site := Site{ID: "1", Country: "US"}
+	ds := matrixsearch.NewDataStore(func(s Site) string { return s.ID }, matrixsearch.AutoIndexer[Site],
+		matrixsearch.WithNormalizer("country"))
+	ds.Insert(site)
+	if got := len(ds.Search("country:US")); got != 0 {
+		t.Errorf("Expected queries to skip the lower tag, got %d results", got)
+	}
+	if got := len(ds.Search("country:us")); got != 1 {
+		t.Errorf("Expected AutoIndexer to have lowered the indexed value, got %d results", got)
+	}
+
+	ds = matrixsearch.NewDataStore(func(s Site) string { return s.ID }, matrixsearch.AutoIndexer[Site],
+		matrixsearch.WithNormalizer("country", matrixsearch.Upper))
+	ds.Insert(site)
+	if got := len(ds.Search("country:uS")); got != 1 {
+		t.Errorf("Expected the override to run after the lower tag, got %d results", got)
+	}
+	if keys, _ := ds.Compile(matrixsearch.Q().Eq("country", "us")); !reflect.DeepEqual(keys, []string{"country:US"}) {
+		t.Errorf("Expected upper-cased query keys, got %v", keys)
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func proxyIDs(proxies []Proxy) []string {
+	ids := make([]string, len(proxies))
+	for i, p := range proxies {
+		ids[i] = p.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestDeclaredCombinationsMatchPowerSet(t *testing.T) {
+	full := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	declared := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithCombinations("country+speedtype"))
+	snap := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithCombinations("country+speedtype"), matrixsearch.WithSnapshotReads(0))
+	var proxies []Proxy
+	for i := 0; i < 500; i++ {
+		p := randomProxy(i)
+		proxies = append(proxies, p)
+		full.Insert(p)
+		declared.Insert(p)
+		snap.Insert(p)
+	}
+	if got := declared.Stats().KeysByLevel; got[3] != 0 || got[4] != 0 || got[2] == 0 {
+		t.Errorf("Expected only the declared pairs to be materialized, got %v", got)
+	}
+	for _, p := range proxies[:50] {
+		for _, q := range []string{
+			"country:" + p.Geo.Country,
+			"country:" + p.Geo.Country + ":speedtype:" + p.SpeedType,
+			"country:" + p.Geo.Country + ":mobile:" + strconv.FormatBool(p.Mobile),
+			"country:" + p.Geo.Country + ":state:" + p.Geo.State + ":speedtype:" + p.SpeedType + ":mobile:" + strconv.FormatBool(p.Mobile),
+		} {
+			want := proxyIDs(full.Search(q))
+			if got := proxyIDs(declared.Search(q)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Search(%q): expected %v, got %v", q, want, got)
+			}
+			if got := proxyIDs(snap.Search(q)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Snapshot Search(%q): expected %v, got %v", q, want, got)
+			}
+			if r, ok := declared.SearchRandom(q); !ok || len(want) == 0 || sort.SearchStrings(want, r.ID) == len(want) {
+				t.Fatalf("SearchRandom(%q) returned %v, %t", q, r.ID, ok)
+			}
+		}
+	}
+	got, err := declared.Query(matrixsearch.Q().In("country", "us", "ca").Eq("mobile", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := full.Query(matrixsearch.Q().In("country", "us", "ca").Eq("mobile", true))
+	if !reflect.DeepEqual(proxyIDs(got), proxyIDs(want)) {
+		t.Errorf("Expected Query to match the power-set store")
+	}
+}
+
+func TestPlannerStrategy(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithCombinations("speedtype+country"))
+	for i := 0; i < 100; i++ {
+		p := randomProxy(i)
+		p.Geo.Country, p.SpeedType, p.Mobile = "us", "fast", i%2 == 0
+		ds.Insert(p)
+	}
+	if p := ds.Explain("speedtype:fast:country:us"); p.Strategy != "composite" || p.Actual != 100 {
+		t.Errorf("Expected the declared combination to be read directly, got\n%s", p)
+	}
+	p := ds.Explain("country:us:speedtype:fast:mobile:true")
+	if p.Strategy != "intersection" || p.Actual != 50 {
+		t.Fatalf("Expected an intersection finding 50 items, got\n%s", p)
+	}
+	if want := []string{"mobile:true", "speedtype:fast:country:us"}; !reflect.DeepEqual(p.Order, want) {
+		t.Errorf("Expected the planner to use the combination and the smaller list first, got %v", p.Order)
+	}
+	if p := ds.Explain("country:us:mobile:maybe"); p.Strategy != "none" || p.Actual != 0 {
+		t.Errorf("Expected no results, got\n%s", p)
+	}
+}
+
+func TestIntersectionSeesUpdates(t *testing.T) {
+	for _, opts := range [][]matrixsearch.Option{
+		{matrixsearch.WithCombinations("country+speedtype")},
+		{matrixsearch.WithCombinations("country+speedtype"), matrixsearch.WithSnapshotReads(0)},
+	} {
+		ds := matrixsearch.NewDataStore(getProxyID, indexProxy, opts...)
+		p := randomProxy(1)
+		p.Geo.Country, p.SpeedType, p.Mobile = "us", "fast", true
+		ds.Insert(p)
+		if got := ds.Search("country:us:speedtype:fast:mobile:true"); len(got) != 1 {
+			t.Fatalf("Expected the item to be found, got %v", got)
+		}
+		p.Mobile = false
+		ds.Update(p)
+		if got := ds.Search("country:us:speedtype:fast:mobile:true"); len(got) != 0 {
+			t.Errorf("Expected the updated item to stop matching, got %v", got)
+		}
+		if got := ds.Snapshot().Search("country:us:speedtype:fast:mobile:false"); len(got) != 1 {
+			t.Errorf("Expected the snapshot to match the updated item, got %v", got)
+		}
+	}
+}
+
+func BenchmarkIntersection(b *testing.B) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithCombinations("country+speedtype"))
+	proxies := make([]Proxy, 400000)
+	for i := range proxies {
+		proxies[i] = randomProxy(i)
+	}
+	ds.InsertMany(proxies)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ds.SearchRandom("country:us:mobile:true")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/xvertile/matrixsearch"
 	"math/rand"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -186,14 +187,12 @@ func BenchmarkProxySearchRandom(b *testing.B) {
 	for _, size := range sizes {
 		b.Run(fmt.Sprintf("Size_%d", size), func(b *testing.B) {
 			ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
-			var known Proxy
-			for i := 0; i < size; i++ {
-				p := randomProxy(i)
-				ds.Insert(p)
-				if i == size/2 {
-					known = p
-				}
+			proxies := make([]Proxy, size)
+			for i := range proxies {
+				proxies[i] = randomProxy(i)
 			}
+			ds.InsertMany(proxies)
+			known := proxies[size/2]
 			query := "country:" + known.Geo.Country + ":state:" + known.Geo.State + ":speedtype:" + known.SpeedType + ":mobile:" + fmt.Sprintf("%t", known.Mobile)
 			b.Log("Proxy SearchRandom Benchmark - Size:", size, "Query:", query)
 			b.ResetTimer()
@@ -206,3 +205,276 @@ func BenchmarkProxySearchRandom(b *testing.B) {
 		})
 	}
 }
+
+func TestProxyGetByID(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	for i := 0; i < 5; i++ {
+		ds.Insert(randomProxy(i))
+	}
+	p, ok := ds.Get("3")
+	if !ok || p.ID != "3" {
+		t.Fatalf("Expected proxy 3, got %+v (found=%v)", p, ok)
+	}
+	if _, ok := ds.Get("42"); ok {
+		t.Error("Expected no proxy for unknown ID")
+	}
+	if !ds.Has("0") || ds.Has("42") {
+		t.Error("Has returned an unexpected result")
+	}
+	many := ds.GetMany([]string{"4", "42", "1"})
+	if len(many) != 2 || many[0].ID != "4" || many[1].ID != "1" {
+		t.Errorf("Unexpected GetMany result: %+v", many)
+	}
+	ids := ds.IDs()
+	if fmt.Sprint(ids) != "[0 1 2 3 4]" {
+		t.Errorf("Unexpected IDs: %v", ids)
+	}
+	if all := ds.All(); len(all) != 5 || all[2].ID != "2" {
+		t.Errorf("Unexpected All result: %+v", all)
+	}
+}
+
+func TestProxyDeleteByID(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(7)
+	ds.Insert(p)
+	if !ds.DeleteByID(p.ID) {
+		t.Fatal("Expected DeleteByID to remove the proxy")
+	}
+	if ds.DeleteByID(p.ID) {
+		t.Error("Expected second DeleteByID to report nothing removed")
+	}
+	if results := ds.Search("country:" + p.Geo.Country); len(results) != 0 {
+		t.Errorf("Expected no results after DeleteByID, got %d", len(results))
+	}
+	if ds.Count() != 0 {
+		t.Errorf("Expected empty store, got %d items", ds.Count())
+	}
+}
+
+func TestProxyUpdateRemovesStaleKeys(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(8)
+	p.SpeedType = "slow"
+	ds.Insert(p)
+	p.SpeedType = "fast"
+	ds.Update(p)
+	if results := ds.Search("speedtype:slow"); len(results) != 0 {
+		t.Errorf("Expected stale key to be empty after update, got %d results", len(results))
+	}
+	if results := ds.Search("speedtype:fast"); len(results) != 1 {
+		t.Errorf("Expected 1 result for new key, got %d", len(results))
+	}
+}
+
+func TestProxyInsertMany(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	var proxies []Proxy
+	for i := 0; i < 100; i++ {
+		proxies = append(proxies, randomProxy(i))
+	}
+	ds.InsertMany(proxies)
+	if ds.Count() != 100 {
+		t.Fatalf("Expected 100 proxies, got %d", ds.Count())
+	}
+	for _, p := range proxies[:10] {
+		found := false
+		for _, r := range ds.Search("country:" + p.Geo.Country + ":state:" + p.Geo.State) {
+			if r.ID == p.ID {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected proxy %s to be indexed", p.ID)
+		}
+	}
+	if removed := ds.DeleteMany(proxies[:50]); removed != 50 {
+		t.Errorf("Expected 50 proxies removed, got %d", removed)
+	}
+	total := 0
+	for _, c := range []string{"us", "ca", "uk", "de", "fr"} {
+		total += len(ds.Search("country:" + c))
+	}
+	if total != 50 {
+		t.Errorf("Expected 50 indexed proxies after DeleteMany, got %d", total)
+	}
+}
+
+func TestProxyApplyBatch(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	a, b, c := randomProxy(1), randomProxy(2), randomProxy(3)
+	ds.InsertMany([]Proxy{a, b})
+	a.SpeedType = "batched"
+	ds.ApplyBatch([]matrixsearch.Op[Proxy]{
+		matrixsearch.InsertOp(a),
+		matrixsearch.DeleteIDOp[Proxy](b.ID),
+		matrixsearch.InsertOp(c),
+		matrixsearch.DeleteOp(c),
+		matrixsearch.InsertOp(c),
+	})
+	if ds.Count() != 2 || ds.Has(b.ID) {
+		t.Fatalf("Unexpected store contents: %v", ds.IDs())
+	}
+	if results := ds.Search("speedtype:batched"); len(results) != 1 || results[0].ID != a.ID {
+		t.Errorf("Expected replaced proxy under new key, got %+v", results)
+	}
+	if results := ds.Search("country:" + c.Geo.Country + ":state:" + c.Geo.State); len(results) != 1 {
+		t.Errorf("Expected proxy %s indexed once, got %d results", c.ID, len(results))
+	}
+}
+
+func BenchmarkProxyInsertMany(b *testing.B) {
+	proxies := make([]Proxy, 100000)
+	for i := range proxies {
+		proxies[i] = randomProxy(i)
+	}
+	b.Run("Insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+			for _, p := range proxies {
+				ds.Insert(p)
+			}
+		}
+	})
+	b.Run("InsertMany", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+			ds.InsertMany(proxies)
+		}
+	})
+}
+
+func TestProxyTxnCommit(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	old := []Proxy{randomProxy(1), randomProxy(2)}
+	ds.InsertMany(old)
+	err := ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		for _, p := range old {
+			tx.Delete(p)
+		}
+		for i := 10; i < 13; i++ {
+			tx.Insert(randomProxy(i))
+		}
+		if tx.Has("1") || !tx.Has("10") {
+			t.Error("Expected transaction to observe its own writes")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ds.IDs()) != "[10 11 12]" {
+		t.Errorf("Unexpected IDs after commit: %v", ds.IDs())
+	}
+}
+
+func TestProxyTxnRollback(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(1)
+	p.SpeedType = "slow"
+	ds.Insert(p)
+	query := "country:" + p.Geo.Country + ":speedtype:slow"
+	before := len(ds.Search(query))
+	errAbort := fmt.Errorf("abort")
+	err := ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		q := p
+		q.SpeedType = "fast"
+		tx.Update(q)
+		tx.Insert(randomProxy(2))
+		tx.DeleteByID(p.ID)
+		tx.Insert(p)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Expected abort error, got %v", err)
+	}
+	if fmt.Sprint(ds.IDs()) != "[1]" {
+		t.Errorf("Unexpected IDs after rollback: %v", ds.IDs())
+	}
+	if got := len(ds.Search(query)); got != before {
+		t.Errorf("Expected %d results after rollback, got %d", before, got)
+	}
+	if got := len(ds.Search("speedtype:fast")); got != 0 {
+		t.Errorf("Expected no fast proxies after rollback, got %d", got)
+	}
+	ds.DeleteByID(p.ID)
+	if got := len(ds.Search(query)); got != 0 {
+		t.Errorf("Expected restored keys to be deletable, got %d results", got)
+	}
+}
+
+func TestProxyTxnPanicRollsBack(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	ds.Insert(randomProxy(1))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic to propagate")
+			}
+		}()
+		ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+			tx.DeleteByID("1")
+			panic("boom")
+		})
+	}()
+	if !ds.Has("1") {
+		t.Error("Expected delete to be rolled back after panic")
+	}
+}
+
+func TestProxyCompareAndSwap(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(1)
+	if ok, err := ds.CompareAndSwap(p.ID, 0, p); !ok || err != nil {
+		t.Fatal("Expected CompareAndSwap with version 0 to insert an absent proxy")
+	}
+	_, v1, ok := ds.GetWithVersion(p.ID)
+	if !ok || v1 == 0 {
+		t.Fatalf("Expected a non-zero version, got %d (found=%v)", v1, ok)
+	}
+	p.SpeedType = "fast"
+	if ok, err := ds.CompareAndSwap(p.ID, v1, p); !ok || err != nil {
+		t.Fatal("Expected CompareAndSwap with current version to succeed")
+	}
+	got, v2, _ := ds.GetWithVersion(p.ID)
+	if v2 == v1 || got.SpeedType != "fast" {
+		t.Errorf("Expected a new version and updated proxy, got version %d and %+v", v2, got)
+	}
+	p.SpeedType = "slow"
+	if ok, err := ds.CompareAndSwap(p.ID, v1, p); ok || err != nil {
+		t.Error("Expected CompareAndSwap with a stale version to fail")
+	}
+	if ok, err := ds.CompareAndSwap(p.ID, 0, p); ok || err != nil {
+		t.Error("Expected CompareAndSwap with version 0 to fail for a present proxy")
+	}
+	if results := ds.Search("speedtype:slow"); len(results) != 0 {
+		t.Errorf("Expected failed swaps to leave the index untouched, got %d results", len(results))
+	}
+}
+
+func TestProxyCompareAndSwapConcurrent(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(1)
+	p.Speed = 0
+	ds.Insert(p)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for {
+					cur, v, _ := ds.GetWithVersion(p.ID)
+					cur.Speed++
+					if ok, _ := ds.CompareAndSwap(p.ID, v, cur); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := ds.Get(p.ID); got.Speed != 800 {
+		t.Errorf("Expected 800 increments, got %d", got.Speed)
+	}
+}
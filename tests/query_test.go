@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"errors"
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+type Server struct {
+	ID        string `text:"id"`
+	Country   string `text:"country"`
+	SpeedType string `text:"speedtype"`
+	Speed     int    `text:"speed"`
+}
+
+func serverStore() *matrixsearch.DataStore[Server] {
+	ds := matrixsearch.NewDataStore(func(s Server) string { return s.ID }, func(s Server) []string {
+		return []string{"country:" + s.Country, "speedtype:" + s.SpeedType, "speed:" + strconv.Itoa(s.Speed)}
+	})
+	ds.InsertMany([]Server{
+		{ID: "1", Country: "us", SpeedType: "fast", Speed: 180},
+		{ID: "2", Country: "us", SpeedType: "medium", Speed: 100},
+		{ID: "3", Country: "us", SpeedType: "slow", Speed: 20},
+		{ID: "4", Country: "de", SpeedType: "fast", Speed: 160},
+	})
+	return ds
+}
+
+func serverIDs(servers []Server) []string {
+	var ids []string
+	for _, s := range servers {
+		ids = append(ids, s.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestQueryCompile(t *testing.T) {
+	ds := serverStore()
+	keys, err := ds.Compile(matrixsearch.Q().Eq("speedtype", "fast").Eq("country", "us"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"country:us:speedtype:fast"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected keys in indexer order %v, got %v", want, keys)
+	}
+	keys, _ = ds.Compile(matrixsearch.Q().In("speedtype", "fast", "medium").Gte("speed", 100))
+	want := []string{"speedtype:fast:speed:100", "speedtype:fast:speed:160", "speedtype:fast:speed:180", "speedtype:medium:speed:100", "speedtype:medium:speed:160", "speedtype:medium:speed:180"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected keys %v, got %v", want, keys)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ds := serverStore()
+	tests := []struct {
+		q    *matrixsearch.Query
+		want []string
+	}{
+		{matrixsearch.Q().Eq("country", "us"), []string{"1", "2", "3"}},
+		{matrixsearch.Q().Eq("country", "us").In("speedtype", "fast", "medium").Gte("speed", 100), []string{"1", "2"}},
+		{matrixsearch.Q().Gt("speed", 100).Lt("speed", 180), []string{"4"}},
+		{matrixsearch.Q().Lte("speed", 100), []string{"2", "3"}},
+		{matrixsearch.Q().Eq("country", "fr"), nil},
+	}
+	for _, tt := range tests {
+		got, err := ds.Query(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := serverIDs(got); !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("Expected %v, got %v", tt.want, ids)
+		}
+	}
+	if s, ok, err := ds.QueryRandom(matrixsearch.Q().Eq("country", "de")); err != nil || !ok || s.ID != "4" {
+		t.Errorf("Expected QueryRandom to return server 4, got %v %v %v", s, ok, err)
+	}
+}
+
+func TestQuerySkippedFields(t *testing.T) {
+	// The first listing has no seller, so rating is ranked before the seller fields.
+	ds := matrixsearch.NewDataStore(func(l Listing) string { return l.ID }, matrixsearch.AutoIndexer[Listing])
+	rating := 5
+	ds.Insert(Listing{ID: "l1", Rating: &rating})
+	ds.Insert(Listing{ID: "l2", Seller: &Manufacturer{Name: "Acme", Country: "US"}, Rating: &rating})
+	if got := len(ds.Search("seller.name:Acme:rating:5")); got != 1 {
+		t.Fatalf("Expected Search to find l2, got %d", got)
+	}
+	got, err := ds.Query(matrixsearch.Q().Eq("seller.name", "Acme").Eq("rating", 5))
+	if err != nil || len(got) != 1 || got[0].ID != "l2" {
+		t.Errorf("Expected Query to find l2, got %v, %v", got, err)
+	}
+	got, _ = ds.Query(matrixsearch.Q().Eq("rating", 5).Gte("rating", 5))
+	if len(got) != 2 {
+		t.Errorf("Expected both listings, got %d", len(got))
+	}
+}
+
+func TestQueryUnknownField(t *testing.T) {
+	ds := serverStore()
+	if _, err := ds.Query(matrixsearch.Q().Eq("contry", "us")); !errors.Is(err, matrixsearch.ErrUnknownField) {
+		t.Errorf("Expected ErrUnknownField, got %v", err)
+	}
+	ds.Clear()
+	if _, err := ds.Query(matrixsearch.Q().Eq("country", "us")); !errors.Is(err, matrixsearch.ErrUnknownField) {
+		t.Errorf("Expected fields to be forgotten by Clear, got %v", err)
+	}
+	ds.Insert(Server{ID: "1", Country: "us", SpeedType: "fast", Speed: 180})
+	if got, err := ds.Query(matrixsearch.Q().Eq("country", "us")); err != nil || len(got) != 1 {
+		t.Errorf("Expected the field to be known again after an insert, got %v, %v", got, err)
+	}
+}
+
+func TestQueryTracksWrites(t *testing.T) {
+	ds := serverStore()
+	ds.DeleteByID("2")
+	ds.Update(Server{ID: "3", Country: "us", SpeedType: "slow", Speed: 120})
+	got, _ := ds.Query(matrixsearch.Q().Gte("speed", 100).Lt("speed", 150))
+	if ids := serverIDs(got); !reflect.DeepEqual(ids, []string{"3"}) {
+		t.Errorf("Expected only server 3 in range, got %v", ids)
+	}
+	keys, _ := ds.Compile(matrixsearch.Q().Lt("speed", 150))
+	if want := []string{"speed:120"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected removed values to be forgotten, got %v", keys)
+	}
+}
+
+func TestQueryRangeManyValues(t *testing.T) {
+	ds := serverStore()
+	for i := 0; i < 2000; i++ {
+		ds.Insert(Server{ID: "x" + strconv.Itoa(i), Country: "fr", Speed: 1000 + i%500})
+	}
+	for i := 0; i < 2000; i += 4 {
+		ds.DeleteByID("x" + strconv.Itoa(i))
+	}
+	// Speeds from 1000 to 1499 are held by four servers each, except that every fourth
+	// speed has lost all of them.
+	keys, _ := ds.Compile(matrixsearch.Q().Gt("speed", 1200).Lte("speed", 1210))
+	var want []string
+	for speed := 1201; speed <= 1210; speed++ {
+		if speed%4 != 0 {
+			want = append(want, "speed:"+strconv.Itoa(speed))
+		}
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected the values in range in ascending order %v, got %v", want, keys)
+	}
+	if got, _ := ds.Query(matrixsearch.Q().Gte("speed", 1490)); len(got) != 32 {
+		t.Errorf("Expected 32 servers at 1490 and above, got %d", len(got))
+	}
+	if got, _ := ds.Query(matrixsearch.Q().Lt("speed", 100)); !reflect.DeepEqual(serverIDs(got), []string{"3"}) {
+		t.Errorf("Expected only server 3 below 100, got %v", serverIDs(got))
+	}
+}
+
+func TestShardedQuery(t *testing.T) {
+	s := matrixsearch.NewShardedDataStore(4, func(s Server) string { return s.ID }, func(s Server) []string {
+		return []string{"country:" + s.Country, "speed:" + strconv.Itoa(s.Speed)}
+	})
+	s.Insert(Server{ID: "1", Country: "us", Speed: 180})
+	s.Insert(Server{ID: "2", Country: "us", Speed: 40})
+	got, err := s.Query(matrixsearch.Q().Eq("country", "us").Gte("speed", 100))
+	if err != nil || len(got) != 1 || got[0].ID != "1" {
+		t.Errorf("Expected server 1, got %v %v", got, err)
+	}
+	if _, _, err := s.QueryRandom(matrixsearch.Q().Eq("region", "eu")); !errors.Is(err, matrixsearch.ErrUnknownField) {
+		t.Errorf("Expected ErrUnknownField, got %v", err)
+	}
+}
+
+func BenchmarkQueryRanges(b *testing.B) {
+	ds := matrixsearch.NewDataStore(func(s Server) string { return s.ID }, func(s Server) []string {
+		return []string{"country:" + s.Country, "speed:" + strconv.Itoa(s.Speed), "id:" + s.ID}
+	})
+	for i := 0; i < 3000; i++ {
+		ds.Insert(Server{ID: strconv.Itoa(i), Country: "us", Speed: i})
+	}
+	q := matrixsearch.Q().Gte("speed", 100).Lt("id", 2000).Eq("country", "us")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got, _ := ds.Query(q); len(got) != 1900 {
+			b.Fatalf("Expected 1900 servers, got %d", len(got))
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package tests
+
+import (
+	"errors"
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newSchemaStore(opts ...matrixsearch.Option) *matrixsearch.DataStore[Proxy] {
+	opts = append(opts, matrixsearch.WithIndexes(
+		matrixsearch.UniqueIndex("ip", func(p Proxy) string { return p.IP }),
+		matrixsearch.RangeIndex("speed", func(p Proxy) float64 { return float64(p.Speed) }),
+		matrixsearch.HashIndex("country", func(p Proxy) []string { return []string{p.Geo.Country} }),
+		matrixsearch.TextIndex("asn", func(p Proxy) string { return p.ASN.Name }),
+	))
+	return matrixsearch.NewDataStore(getProxyID, func(p Proxy) []string {
+		return []string{"state:" + p.Geo.State, "speedtype:" + p.SpeedType}
+	}, opts...)
+}
+
+func schemaProxy(id, ip string, speed int, country, state, asn string) Proxy {
+	speedType := "slow"
+	if speed > 100 {
+		speedType = "fast"
+	}
+	return Proxy{ID: id, IP: ip, Speed: speed, SpeedType: speedType, Geo: Geo{Country: country, State: state}, ASN: ASN{Name: asn}}
+}
+
+func TestSchemaIndexesRouteQueries(t *testing.T) {
+	ds := newSchemaStore()
+	ds.Insert(schemaProxy("1", "10.0.0.1", 50, "us", "ca", "Comcast Cable"))
+	ds.Insert(schemaProxy("2", "10.0.0.2", 120, "us", "ny", "Verizon Business"))
+	ds.Insert(schemaProxy("3", "10.0.0.3", 180, "de", "be", "Deutsche Telekom"))
+	ds.Insert(schemaProxy("4", "10.0.0.4", 150, "us", "ca", "Comcast Business"))
+
+	tests := []struct {
+		q    *matrixsearch.Query
+		want []string
+	}{
+		{matrixsearch.Q().Eq("ip", "10.0.0.3"), []string{"3"}},
+		{matrixsearch.Q().In("ip", "10.0.0.1", "10.0.0.9", "10.0.0.2"), []string{"1", "2"}},
+		{matrixsearch.Q().Gte("speed", 120), []string{"2", "3", "4"}},
+		{matrixsearch.Q().Gt("speed", 120).Lt("speed", 180), []string{"4"}},
+		{matrixsearch.Q().Eq("speed", 50), []string{"1"}},
+		{matrixsearch.Q().Eq("country", "us").Gte("speed", 100), []string{"2", "4"}},
+		{matrixsearch.Q().Match("asn", "comcast"), []string{"1", "4"}},
+		{matrixsearch.Q().Match("asn", "Business COMCAST"), []string{"4"}},
+		{matrixsearch.Q().Eq("state", "ca").Match("asn", "business"), []string{"4"}},
+		{matrixsearch.Q().Eq("state", "ca").Eq("speedtype", "fast").Eq("country", "us"), []string{"4"}},
+		{matrixsearch.Q().Eq("state", "ny").Eq("ip", "10.0.0.1"), nil},
+		{matrixsearch.Q().Match("asn", "telekom").Lt("speed", 100), nil},
+	}
+	for _, tt := range tests {
+		got, err := ds.Query(tt.q)
+		if err != nil {
+			t.Fatalf("Query(%s): %v", tt.q, err)
+		}
+		if ids := proxyIDs(got); !reflect.DeepEqual(ids, tt.want) && !(len(ids) == 0 && len(tt.want) == 0) {
+			t.Errorf("Query(%s): expected %v, got %v", tt.q, tt.want, ids)
+		}
+	}
+
+	for _, q := range []*matrixsearch.Query{
+		matrixsearch.Q().Match("country", "us"),
+		matrixsearch.Q().Match("state", "ca"),
+		matrixsearch.Q().Gt("ip", 1),
+		matrixsearch.Q().Eq("speed", "fast"),
+	} {
+		if _, err := ds.Query(q); err == nil {
+			t.Errorf("Query(%s): expected an error", q)
+		}
+	}
+	if _, err := ds.Query(matrixsearch.Q().Eq("nope", "x")); !errors.Is(err, matrixsearch.ErrUnknownField) {
+		t.Errorf("Expected ErrUnknownField, got %v", err)
+	}
+	if keys, err := ds.Compile(matrixsearch.Q().Eq("state", "ca").Eq("ip", "10.0.0.1")); err != nil || !reflect.DeepEqual(keys, []string{"state:ca"}) {
+		t.Errorf("Expected Compile to leave out index terms, got %v, %v", keys, err)
+	}
+}
+
+func TestSchemaIndexesFollowWrites(t *testing.T) {
+	ds := newSchemaStore()
+	ds.Insert(schemaProxy("1", "10.0.0.1", 50, "us", "ca", "Comcast"))
+	ds.Insert(schemaProxy("2", "10.0.0.2", 120, "us", "ny", "Verizon"))
+
+	// Updating an item moves it in every index.
+	ds.Update(schemaProxy("1", "10.0.0.9", 160, "de", "be", "Telekom"))
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.1"))
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.9"), "1")
+	expectQuery(t, ds, matrixsearch.Q().Lt("speed", 100))
+	expectQuery(t, ds, matrixsearch.Q().Eq("country", "de"), "1")
+	expectQuery(t, ds, matrixsearch.Q().Match("asn", "comcast"))
+
+	// A unique value taken by another item replaces it.
+	ds.Insert(schemaProxy("3", "10.0.0.2", 10, "us", "tx", "AT&T"))
+	if _, ok := ds.Get("2"); ok {
+		t.Error("Expected the previous holder of the IP to be replaced")
+	}
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.2"), "3")
+	expectQuery(t, ds, matrixsearch.Q().Eq("country", "us"), "3")
+
+	ds.ApplyBatch([]matrixsearch.Op[Proxy]{
+		matrixsearch.InsertOp(schemaProxy("4", "10.0.0.4", 70, "fr", "pa", "Orange")),
+		matrixsearch.InsertOp(schemaProxy("5", "10.0.0.4", 80, "fr", "ly", "Free")),
+		matrixsearch.DeleteIDOp[Proxy]("1"),
+	})
+	expectQuery(t, ds, matrixsearch.Q().Eq("country", "fr"), "5")
+	expectQuery(t, ds, matrixsearch.Q().Gte("speed", 0), "3", "5")
+
+	err := ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		tx.Insert(schemaProxy("6", "10.0.0.3", 90, "it", "ro", "Fastweb"))
+		tx.Insert(schemaProxy("7", "10.0.0.4", 95, "it", "mi", "Tim"))
+		tx.DeleteByID("3")
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.4"), "5")
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.3"))
+	expectQuery(t, ds, matrixsearch.Q().Gte("speed", 0), "3", "5")
+	expectQuery(t, ds, matrixsearch.Q().Match("asn", "free"), "5")
+
+	ds.DeleteMany([]Proxy{{ID: "3"}})
+	expectQuery(t, ds, matrixsearch.Q().Eq("country", "us"))
+	ds.Clear()
+	expectQuery(t, ds, matrixsearch.Q().Gte("speed", 0))
+	expectQuery(t, ds, matrixsearch.Q().Eq("ip", "10.0.0.4"))
+}
+
+func TestSchemaIndexesWithoutIndexer(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, nil, matrixsearch.WithIndexes(
+		matrixsearch.HashIndex("country", func(p Proxy) []string { return []string{p.Geo.Country} }),
+		matrixsearch.RangeIndex("speed", func(p Proxy) float64 { return float64(p.Speed) }),
+	), matrixsearch.WithNormalizer("country", matrixsearch.Lower))
+	for i := 0; i < 100; i++ {
+		p := randomProxy(i)
+		p.Geo.Country = "US"
+		p.Speed = i
+		ds.Insert(p)
+	}
+	var want []string
+	for i := 10; i < 20; i++ {
+		want = append(want, strconv.Itoa(i))
+	}
+	expectQuery(t, ds, matrixsearch.Q().Eq("country", "Us").Gte("speed", 10).Lt("speed", 20), want...)
+	if got := ds.Search("country:us"); len(got) != 0 {
+		t.Errorf("Expected no composite keys without an indexer, got %d items", len(got))
+	}
+}
+
+func TestRangeIndexManyWrites(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, nil, matrixsearch.WithIndexes(
+		matrixsearch.RangeIndex("speed", func(p Proxy) float64 { return float64(p.Speed) }),
+	))
+	speeds := make(map[string]int)
+	var batch []Proxy
+	for i := 0; i < 5000; i++ {
+		p := Proxy{ID: strconv.Itoa(i), Speed: (i * 7919) % 1000}
+		speeds[p.ID] = p.Speed
+		if i%2 == 0 {
+			ds.Insert(p)
+		} else {
+			batch = append(batch, p)
+		}
+	}
+	ds.InsertMany(batch)
+	for i := 0; i < 5000; i += 3 {
+		id := strconv.Itoa(i)
+		if i%2 == 0 {
+			ds.DeleteByID(id)
+			delete(speeds, id)
+		} else {
+			ds.Update(Proxy{ID: id, Speed: 500})
+			speeds[id] = 500
+		}
+	}
+	for _, r := range [][2]float64{{0, 1000}, {100, 101}, {499, 502}, {990, 2000}, {600, 400}} {
+		var want []string
+		for id, speed := range speeds {
+			if f := float64(speed); f >= r[0] && f < r[1] {
+				want = append(want, id)
+			}
+		}
+		sort.Strings(want)
+		expectQuery(t, ds, matrixsearch.Q().Gte("speed", r[0]).Lt("speed", r[1]), want...)
+	}
+}
+
+func TestWithIndexesPanics(t *testing.T) {
+	for name, opt := range map[string]matrixsearch.Option{
+		"duplicate": matrixsearch.WithIndexes(
+			matrixsearch.HashIndex("country", func(p Proxy) []string { return nil }),
+			matrixsearch.UniqueIndex("country", func(p Proxy) string { return "" }),
+		),
+		"type": matrixsearch.WithIndexes(matrixsearch.HashIndex("name", func(f Fruit) []string { return nil })),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected NewDataStore to panic", name)
+				}
+			}()
+			matrixsearch.NewDataStore(getProxyID, indexProxy, opt)
+		}()
+	}
+}
+
+func TestUniqueIndexRejectsDuplicates(t *testing.T) {
+	hooks := &recordingHooks{}
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithIndexes(
+		matrixsearch.UniqueIndex("ip", func(p Proxy) string { return p.IP }).OnConflict(matrixsearch.ConflictReject),
+	), matrixsearch.WithNormalizer("ip", matrixsearch.Trim), matrixsearch.WithHooks(hooks))
+	if err := ds.Insert(schemaProxy("1", "10.0.0.1", 50, "us", "ca", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Insert(schemaProxy("2", " 10.0.0.1", 60, "de", "be", "")); !errors.Is(err, matrixsearch.ErrDuplicate) {
+		t.Fatalf("Expected ErrDuplicate, got %v", err)
+	}
+	if _, ok := ds.Get("2"); ok || ds.Count() != 1 || len(ds.Search("country:de")) != 0 {
+		t.Error("Expected the rejected item not to be stored")
+	}
+	// An item may keep its own value, and a freed value can be taken.
+	if err := ds.Update(schemaProxy("1", "10.0.0.1", 70, "us", "ca", "")); err != nil {
+		t.Fatal(err)
+	}
+	ds.Update(schemaProxy("1", "10.0.0.5", 70, "us", "ca", ""))
+	if err := ds.Insert(schemaProxy("2", "10.0.0.1", 60, "de", "be", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, ok := ds.GetBy("ip", "10.0.0.5 "); !ok || p.ID != "1" {
+		t.Errorf("Expected GetBy to find item 1, got %v, %t", p.ID, ok)
+	}
+	if _, ok := ds.GetBy("ip", "10.0.0.9"); ok {
+		t.Error("Expected GetBy to miss an unknown value")
+	}
+	if _, ok := ds.GetBy("country", "us"); ok {
+		t.Error("Expected GetBy to miss on a field without a unique index")
+	}
+
+	err := ds.InsertMany([]Proxy{
+		schemaProxy("3", "10.0.0.3", 10, "fr", "pa", ""),
+		schemaProxy("4", "10.0.0.5", 20, "fr", "ly", ""),
+	})
+	if !errors.Is(err, matrixsearch.ErrDuplicate) {
+		t.Fatalf("Expected InsertMany to fail with ErrDuplicate, got %v", err)
+	}
+	if _, ok := ds.Get("3"); ok || len(ds.Search("country:fr")) != 0 {
+		t.Error("Expected a failed batch to apply none of its ops")
+	}
+	if ok, err := ds.CompareAndSwap("3", 0, schemaProxy("3", "10.0.0.3", 10, "fr", "pa", "")); !ok || err != nil {
+		t.Errorf("Expected CompareAndSwap to insert a free value, got %t, %v", ok, err)
+	}
+	if ok, err := ds.CompareAndSwap("4", 0, schemaProxy("4", "10.0.0.3", 10, "fr", "pa", "")); ok || !errors.Is(err, matrixsearch.ErrDuplicate) {
+		t.Errorf("Expected CompareAndSwap to fail with ErrDuplicate, got %t, %v", ok, err)
+	}
+
+	err = ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		if err := tx.Insert(schemaProxy("5", "10.0.0.6", 10, "it", "ro", "")); err != nil {
+			return err
+		}
+		return tx.Insert(schemaProxy("6", "10.0.0.6", 10, "it", "mi", ""))
+	})
+	if !errors.Is(err, matrixsearch.ErrDuplicate) {
+		t.Fatalf("Expected the transaction to fail with ErrDuplicate, got %v", err)
+	}
+	if _, ok := ds.GetBy("ip", "10.0.0.6"); ok {
+		t.Error("Expected the transaction to be rolled back")
+	}
+
+	var errs []string
+	for _, e := range hooks.take() {
+		if strings.HasPrefix(e, "error ") {
+			errs = append(errs, e)
+		}
+	}
+	if want := []string{"error insert", "error batch", "error cas"}; !reflect.DeepEqual(errs, want) {
+		t.Errorf("Expected hooks %v, got %v", want, errs)
+	}
+}
+
+func TestShardedIndexes(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected NewShardedDataStore to refuse a unique index")
+			}
+		}()
+		matrixsearch.NewShardedDataStore(4, getProxyID, indexProxy, matrixsearch.WithIndexes(
+			matrixsearch.UniqueIndex("ip", func(p Proxy) string { return p.IP }),
+		))
+	}()
+
+	ds := matrixsearch.NewShardedDataStore(4, getProxyID, indexProxy, matrixsearch.WithIndexes(
+		matrixsearch.RangeIndex("speed", func(p Proxy) float64 { return float64(p.Speed) }),
+	))
+	for i := 0; i < 50; i++ {
+		p := randomProxy(i)
+		p.Speed = i
+		ds.Insert(p)
+	}
+	got, err := ds.Query(matrixsearch.Q().Gte("speed", 10).Lt("speed", 20))
+	if err != nil || len(got) != 10 {
+		t.Errorf("Expected 10 items from the shards' range indexes, got %d, %v", len(got), err)
+	}
+	if st := ds.Stats(); st.Memory.Indexes <= 0 || len(st.Inconsistent) != 0 {
+		t.Errorf("Expected the merged stats to hold the shards' range indexes, got %+v", st.Memory)
+	}
+	if _, ok := ds.GetBy("speed", "10"); ok {
+		t.Error("Expected GetBy to find nothing without a unique index")
+	}
+}
+
+func expectQuery(t *testing.T, ds *matrixsearch.DataStore[Proxy], q *matrixsearch.Query, want ...string) {
+	t.Helper()
+	got, err := ds.Query(q)
+	if err != nil {
+		t.Fatalf("Query(%s): %v", q, err)
+	}
+	if ids := proxyIDs(got); !reflect.DeepEqual(ids, want) && !(len(ids) == 0 && len(want) == 0) {
+		t.Errorf("Query(%s): expected %v, got %v", q, want, ids)
+	}
+}
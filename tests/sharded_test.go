@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedDataStore(t *testing.T) {
+	ds := matrixsearch.NewShardedDataStore(8, getProxyID, indexProxy)
+	var proxies []Proxy
+	for i := 0; i < 200; i++ {
+		proxies = append(proxies, randomProxy(i))
+	}
+	ds.InsertMany(proxies)
+	if ds.Count() != 200 {
+		t.Fatalf("Expected 200 proxies, got %d", ds.Count())
+	}
+	p := proxies[42]
+	if got, ok := ds.Get(p.ID); !ok || got.ID != p.ID {
+		t.Errorf("Expected to get proxy %s", p.ID)
+	}
+	query := "country:" + p.Geo.Country
+	expected := 0
+	for _, q := range proxies {
+		if q.Geo.Country == p.Geo.Country {
+			expected++
+		}
+	}
+	if got := len(ds.Search(query)); got != expected {
+		t.Errorf("Expected %d results for %s, got %d", expected, query, got)
+	}
+	if !ds.DeleteByID(p.ID) || ds.Has(p.ID) {
+		t.Error("Expected DeleteByID to remove the proxy")
+	}
+	if got := len(ds.IDs()); got != 199 {
+		t.Errorf("Expected 199 IDs, got %d", got)
+	}
+	ds.Clear()
+	if _, ok := ds.SearchRandom(query); ok {
+		t.Error("Expected no results after Clear")
+	}
+}
+
+func TestShardedSearchRandomWeighting(t *testing.T) {
+	ds := matrixsearch.NewShardedDataStore(4, getProxyID, indexProxy)
+	for i := 0; i < 20; i++ {
+		p := randomProxy(i)
+		p.SpeedType = "fast"
+		ds.Insert(p)
+	}
+	seen := make(map[string]int)
+	const draws = 20000
+	for i := 0; i < draws; i++ {
+		p, ok := ds.SearchRandom("speedtype:fast")
+		if !ok {
+			t.Fatal("Expected a random result")
+		}
+		seen[p.ID]++
+	}
+	if len(seen) != 20 {
+		t.Fatalf("Expected all 20 proxies to be drawn, got %d", len(seen))
+	}
+	for id, n := range seen {
+		if n < draws/20/2 || n > draws/20*2 {
+			t.Errorf("Proxy %s drawn %d times, expected about %d", id, n, draws/20)
+		}
+	}
+}
+
+func TestShardedConcurrentUpdates(t *testing.T) {
+	ds := matrixsearch.NewShardedDataStore(16, getProxyID, indexProxy)
+	for i := 0; i < 100; i++ {
+		ds.Insert(randomProxy(i))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				ds.Update(randomProxy((w*500 + i) % 100))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				ds.SearchRandom("speedtype:fast")
+			}
+		}()
+	}
+	wg.Wait()
+	if ds.Count() != 100 {
+		t.Errorf("Expected 100 proxies, got %d", ds.Count())
+	}
+}
+
+func TestShardedTxn(t *testing.T) {
+	ds := matrixsearch.NewShardedDataStore(8, getProxyID, indexProxy)
+	var proxies []Proxy
+	for i := 0; i < 20; i++ {
+		proxies = append(proxies, randomProxy(i))
+	}
+	err := ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		for _, p := range proxies {
+			tx.Insert(p)
+		}
+		if len(tx.Search("country:"+proxies[0].Geo.Country)) == 0 {
+			t.Error("Expected the transaction to see its own inserts")
+		}
+		return errors.New("abort")
+	})
+	if err == nil || ds.Count() != 0 {
+		t.Fatalf("Expected the transaction to be rolled back on every shard, got %v and %d items", err, ds.Count())
+	}
+	err = ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		for _, p := range proxies {
+			tx.Insert(p)
+		}
+		tx.DeleteByID(proxies[3].ID)
+		return nil
+	})
+	if err != nil || ds.Count() != 19 || ds.Has(proxies[3].ID) {
+		t.Errorf("Expected 19 committed items, got %v and %d items", err, ds.Count())
+	}
+}
+
+func TestShardedMergedViews(t *testing.T) {
+	sharded := matrixsearch.NewShardedDataStore(8, getProxyID, indexProxy)
+	single := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	var proxies []Proxy
+	for i := 0; i < 200; i++ {
+		proxies = append(proxies, randomProxy(i))
+	}
+	sharded.InsertMany(proxies)
+	single.InsertMany(proxies)
+
+	got, want := sharded.Stats(), single.Stats()
+	if got.Items != want.Items || got.Keys != want.Keys || !reflect.DeepEqual(got.KeysByLevel, want.KeysByLevel) || len(got.Inconsistent) != 0 {
+		t.Errorf("Expected the sharded stats to match a single store, got %+v", got)
+	}
+	p := proxies[0]
+	query := "country:" + p.Geo.Country + ":mobile:" + strconv.FormatBool(p.Mobile)
+	if got, want := sharded.Explain(query), single.Explain(query); got.Actual != want.Actual || got.Strategy != want.Strategy {
+		t.Errorf("Expected the sharded plan to match a single store, got\n%s", got)
+	}
+	q := matrixsearch.Q().Eq("mobile", true).Eq("country", "us")
+	if got, _ := sharded.Compile(q); !reflect.DeepEqual(got, []string{"country:us:mobile:true"}) {
+		t.Errorf("Expected the fields in indexer order, got %v", got)
+	}
+	var gotDump, wantDump strings.Builder
+	sharded.DumpTo(&gotDump, matrixsearch.DumpFormatText)
+	single.DumpTo(&wantDump, matrixsearch.DumpFormatText)
+	if line := strings.SplitN(gotDump.String(), "\n", 2)[0]; line != strings.SplitN(wantDump.String(), "\n", 2)[0] {
+		t.Errorf("Expected the sharded dump to cover the same keys and items, got %q", line)
+	}
+	if got, want := sharded.KeyCount(), single.KeyCount(); got < want {
+		t.Errorf("Expected the shards to hold at least the %d keys of a single store, got %d", want, got)
+	}
+
+	snap := sharded.Snapshot()
+	sharded.DeleteByID(p.ID)
+	if snap.Count() != 200 || !snap.Has(p.ID) || len(snap.IDs()) != 200 {
+		t.Errorf("Expected the snapshot to keep all 200 items, got %d", snap.Count())
+	}
+	if got, want := len(snap.Search(query)), len(single.Search(query)); got != want {
+		t.Errorf("Expected the snapshot to find %d items, got %d", want, got)
+	}
+}
+
+func BenchmarkShardedUpdateWithReaders(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("Shards_%d", shards), func(b *testing.B) {
+			ds := matrixsearch.NewShardedDataStore(shards, getProxyID, indexProxy)
+			for i := 0; i < 10000; i++ {
+				ds.Insert(randomProxy(i))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if i%10 == 0 {
+						ds.Update(randomProxy(i % 10000))
+					} else {
+						ds.SearchRandom("speedtype:fast")
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkUpdateWithSnapshotReads compares Update with and without publishing a
+// snapshot on every write.
+func BenchmarkUpdateWithSnapshotReads(b *testing.B) {
+	for _, size := range []int{10000, 200000} {
+		proxies := make([]Proxy, size)
+		for i := range proxies {
+			proxies[i] = randomProxy(i)
+		}
+		for _, snapshots := range []bool{false, true} {
+			b.Run(fmt.Sprintf("Size_%d/Snapshots_%t", size, snapshots), func(b *testing.B) {
+				var opts []matrixsearch.Option
+				if snapshots {
+					opts = append(opts, matrixsearch.WithSnapshotReads(0))
+				}
+				ds := matrixsearch.NewDataStore(getProxyID, indexProxy, opts...)
+				ds.InsertMany(proxies)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					ds.Update(proxies[i%size])
+				}
+			})
+		}
+	}
+}
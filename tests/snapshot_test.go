@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/xvertile/matrixsearch"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy)
+	p := randomProxy(1)
+	ds.Insert(p)
+	snap := ds.Snapshot()
+	if ds.Snapshot() != snap {
+		t.Error("Expected snapshot to be reused while the store is unchanged")
+	}
+	ds.Insert(randomProxy(2))
+	ds.DeleteByID(p.ID)
+	if snap.Count() != 1 || !snap.Has(p.ID) || snap.Has("2") {
+		t.Errorf("Expected snapshot to keep its original contents, got %v", snap.IDs())
+	}
+	if got := len(snap.Search("country:" + p.Geo.Country)); got != 1 {
+		t.Errorf("Expected 1 result from snapshot, got %d", got)
+	}
+	if fresh := ds.Snapshot(); fresh == snap || fresh.Count() != 1 || !fresh.Has("2") {
+		t.Error("Expected a new snapshot after writes")
+	}
+}
+
+func TestSnapshotReads(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(0))
+	p := randomProxy(1)
+	ds.Insert(p)
+	if got, ok := ds.SearchRandom("country:" + p.Geo.Country); !ok || got.ID != p.ID {
+		t.Fatal("Expected write to be visible to snapshot reads immediately")
+	}
+	p.SpeedType = "fast"
+	ds.Update(p)
+	if got := len(ds.Search("speedtype:fast")); got != 1 {
+		t.Errorf("Expected update to be published, got %d results", got)
+	}
+	ds.Txn(func(tx *matrixsearch.Txn[Proxy]) error {
+		tx.DeleteByID(p.ID)
+		return fmt.Errorf("abort")
+	})
+	if !ds.Has(p.ID) {
+		t.Error("Expected rolled back delete to leave the proxy visible")
+	}
+	ds.Clear()
+	if ds.Count() != 0 || len(ds.Search("speedtype:fast")) != 0 {
+		t.Error("Expected Clear to be published")
+	}
+}
+
+func TestSnapshotReadsBatchedPublication(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(time.Hour))
+	ds.Insert(randomProxy(1))
+	if ds.Count() != 0 {
+		t.Fatal("Expected write to wait for the next publication")
+	}
+	ds.Publish()
+	if ds.Count() != 1 || !ds.Has("1") {
+		t.Fatal("Expected Publish to make the write visible")
+	}
+
+	ds = matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(10*time.Millisecond))
+	ds.Insert(randomProxy(1))
+	deadline := time.Now().Add(time.Second)
+	for !ds.Has("1") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected scheduled publication to make the write visible")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSnapshotReadsAgree(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(time.Hour))
+	ds.Insert(randomProxy(1))
+	ds.Publish()
+	_, v1, _ := ds.GetWithVersion("1")
+	ds.Insert(randomProxy(1))
+	ds.Insert(randomProxy(2))
+	if _, v, _ := ds.GetWithVersion("1"); v != v1 {
+		t.Errorf("Expected GetWithVersion to read the published version %d, got %d", v1, v)
+	}
+	if len(ds.IDs()) != 1 || len(ds.All()) != 1 || len(ds.GetMany([]string{"1", "2"})) != 1 {
+		t.Errorf("Expected IDs, All and GetMany to agree with Count, got %v", ds.IDs())
+	}
+	ds.Publish()
+	if _, v, _ := ds.GetWithVersion("1"); v == v1 || len(ds.All()) != 2 || len(ds.GetMany([]string{"1", "2"})) != 2 {
+		t.Error("Expected Publish to make the writes visible to every read")
+	}
+}
+
+func TestSnapshotReadsManyWrites(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(0))
+	for i := 0; i < 2000; i++ {
+		ds.Insert(randomProxy(i))
+	}
+	before := ds.Snapshot()
+	for i := 0; i < 2000; i += 2 {
+		ds.DeleteByID(strconv.Itoa(i))
+	}
+	after := ds.Snapshot()
+	if before.Count() != 2000 || len(before.IDs()) != 2000 || !before.Has("0") {
+		t.Errorf("Expected the earlier snapshot to keep 2000 items, got %d", before.Count())
+	}
+	if after.Count() != 1000 || len(after.IDs()) != 1000 || after.Has("0") || !after.Has("1") {
+		t.Errorf("Expected the later snapshot to hold 1000 items, got %d", after.Count())
+	}
+	for _, c := range []string{"us", "ca", "uk", "de", "fr"} {
+		live, err := ds.Query(matrixsearch.Q().Eq("country", c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(after.Search("country:" + c)); got != len(live) {
+			t.Errorf("Expected the snapshot to find %d items in %s, got %d", len(live), c, got)
+		}
+	}
+}
+
+func TestSnapshotReadsConcurrent(t *testing.T) {
+	ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(0))
+	for i := 0; i < 100; i++ {
+		ds.Insert(randomProxy(i))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				ds.Update(randomProxy((w*200 + i) % 100))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				snap := ds.Snapshot()
+				n := 0
+				for _, c := range []string{"us", "ca", "uk", "de", "fr"} {
+					n += len(snap.Search("country:" + c))
+				}
+				if n != 100 {
+					t.Errorf("Expected a consistent snapshot of 100 proxies, got %d", n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkProxySearchRandomSnapshot(b *testing.B) {
+	for _, size := range []int{10000, 100000} {
+		b.Run(fmt.Sprintf("Size_%d", size), func(b *testing.B) {
+			ds := matrixsearch.NewDataStore(getProxyID, indexProxy, matrixsearch.WithSnapshotReads(0))
+			proxies := make([]Proxy, size)
+			for i := range proxies {
+				proxies[i] = randomProxy(i)
+			}
+			ds.InsertMany(proxies)
+			known := proxies[size/2]
+			query := "country:" + known.Geo.Country + ":state:" + known.Geo.State + ":speedtype:" + known.SpeedType + ":mobile:" + fmt.Sprintf("%t", known.Mobile)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ds.SearchRandom(query)
+				}
+			})
+		})
+	}
+}
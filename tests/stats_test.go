@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	ds := newFruitStore()
+	ds.DeleteByID("lemon")
+	s := ds.Stats()
+	if s.Items != 2 || s.Keys != 6 || s.EmptyKeys != 3 {
+		t.Errorf("Expected 2 items, 6 keys and 3 empty keys, got %d, %d and %d", s.Items, s.Keys, s.EmptyKeys)
+	}
+	if want := map[int]int{1: 4, 2: 2}; !reflect.DeepEqual(s.KeysByLevel, want) {
+		t.Errorf("Expected keys by level %v, got %v", want, s.KeysByLevel)
+	}
+	wantBuckets := []matrixsearch.PostingBucket{{Min: 0, Max: 0, Keys: 3}, {Min: 1, Max: 1, Keys: 0}, {Min: 2, Max: 3, Keys: 3}}
+	if !reflect.DeepEqual(s.PostingLists, wantBuckets) {
+		t.Errorf("Expected posting list histogram %v, got %v", wantBuckets, s.PostingLists)
+	}
+	if len(s.LargestKeys) != 6 || s.LargestKeys[0] != (matrixsearch.KeyStat{Key: "color:red", Items: 2}) {
+		t.Errorf("Unexpected largest keys %v", s.LargestKeys)
+	}
+	if len(s.Inconsistent) != 0 {
+		t.Errorf("Expected a consistent index, got %v", s.Inconsistent)
+	}
+	m := s.Memory
+	if m.Items <= 0 || m.Index <= 0 || m.ItemKeys <= 0 || m.Fields <= 0 || m.Indexes != 0 || m.Total != m.Items+m.Index+m.ItemKeys+m.Fields {
+		t.Errorf("Unexpected memory estimate %+v", m)
+	}
+}
+
+func TestStatsIndexes(t *testing.T) {
+	ds := matrixsearch.NewDataStore(func(f *Fruit) string { return f.Name }, nil, matrixsearch.WithIndexes(
+		matrixsearch.HashIndex("color", func(f *Fruit) []string { return []string{f.Color} }),
+		matrixsearch.RangeIndex("weight", func(f *Fruit) float64 { return f.Weight }),
+		matrixsearch.TextIndex("taste", func(f *Fruit) string { return f.Taste }),
+		matrixsearch.UniqueIndex("name", func(f *Fruit) string { return f.Name }),
+	))
+	fruits := []*Fruit{
+		{Name: "apple", Color: "red", Weight: 0.2, Taste: "sweet and crisp"},
+		{Name: "lemon", Color: "yellow", Weight: 0.1, Taste: "sour"},
+		{Name: "cherry", Color: "red", Weight: 0.01, Taste: "sweet"},
+	}
+	ds.InsertMany(fruits)
+	ds.DeleteByID("lemon")
+	s := ds.Stats()
+	if len(s.Inconsistent) != 0 {
+		t.Errorf("Expected consistent indexes, got %v", s.Inconsistent)
+	}
+	m := s.Memory
+	if m.Indexes <= 0 || m.Total != m.Items+m.Index+m.ItemKeys+m.Fields+m.Indexes {
+		t.Errorf("Expected the memory estimate to cover the indexes, got %+v", m)
+	}
+
+	// Changing items behind the store's back leaves their index entries stale.
+	fruits[0].Color = "green"
+	fruits[2].Weight = 0.02
+	if got := ds.Stats().Inconsistent; !reflect.DeepEqual(got, []string{"apple", "cherry"}) {
+		t.Errorf("Expected apple and cherry to be reported, got %v", got)
+	}
+}
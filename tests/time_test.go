@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"github.com/xvertile/matrixsearch"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type Probe struct {
+	ID       string        `text:"id"`
+	LastSeen time.Time     `text:"lastseen,day,hour"`
+	Checked  *time.Time    `text:"checked"`
+	Latency  time.Duration `text:"latency"`
+	Created  time.Time
+}
+
+func TestAutoIndexerTime(t *testing.T) {
+	seen := time.Date(2026, 10, 18, 14, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	p := Probe{ID: "1", LastSeen: seen, Latency: 1500 * time.Millisecond, Created: seen}
+	want := []string{
+		"id:1",
+		"lastseen:" + strconv.FormatInt(seen.Unix(), 10),
+		"lastseen.day:2026-10-18",
+		"lastseen.hour:2026-10-18T12",
+		"latency:1.5",
+	}
+	if got := matrixsearch.AutoIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %v, got %v", want, got)
+	}
+	if got := ProbeIndexer(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected generated keys %v, got %v", want, got)
+	}
+	if got := matrixsearch.AutoIndexer(Probe{ID: "2"}); !reflect.DeepEqual(got, []string{"id:2", "latency:0"}) {
+		t.Errorf("Expected zero times to be skipped, got %v", got)
+	}
+}
+
+func TestQuerySinceAfterZeroTime(t *testing.T) {
+	// The first probe has no last seen time, so latency is ranked before lastseen.
+	ds := matrixsearch.NewDataStore(func(p Probe) string { return p.ID }, matrixsearch.AutoIndexer[Probe])
+	ds.Insert(Probe{ID: "new"})
+	ds.Insert(Probe{ID: "seen", LastSeen: time.Now().Add(-time.Minute)})
+	got, err := ds.Query(matrixsearch.Q().Since("lastseen", time.Hour).Eq("latency", 0))
+	if err != nil || len(got) != 1 || got[0].ID != "seen" {
+		t.Errorf("Expected the seen probe, got %v, %v", got, err)
+	}
+}
+
+func TestQuerySince(t *testing.T) {
+	ds := matrixsearch.NewDataStore(func(p Probe) string { return p.ID }, matrixsearch.AutoIndexer[Probe])
+	now := time.Now()
+	ds.Insert(Probe{ID: "fresh", LastSeen: now.Add(-time.Minute)})
+	ds.Insert(Probe{ID: "stale", LastSeen: now.Add(-time.Hour)})
+	ds.Insert(Probe{ID: "slow", LastSeen: now.Add(-2 * time.Minute), Latency: 3 * time.Second})
+	got, err := ds.Query(matrixsearch.Q().Since("lastseen", 5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Expected 2 probes seen in the last 5 minutes, got %d", len(got))
+	}
+	got, _ = ds.Query(matrixsearch.Q().Since("lastseen", 5*time.Minute).Lt("latency", 1))
+	if len(got) != 1 || got[0].ID != "fresh" {
+		t.Errorf("Expected only the fresh probe, got %v", got)
+	}
+	got, _ = ds.Query(matrixsearch.Q().Before("lastseen", now.Add(-30*time.Minute)))
+	if len(got) != 1 || got[0].ID != "stale" {
+		t.Errorf("Expected only the stale probe, got %v", got)
+	}
+	day := now.Add(-time.Hour).UTC().Format("2006-01-02")
+	if got := ds.Search("lastseen.day:" + day); len(got) == 0 {
+		t.Errorf("Expected probes in the %s bucket", day)
+	}
+}
@@ -0,0 +1,72 @@
+package matrixsearch
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// timeBuckets maps the tag options of a time.Time field to the layouts of the derived
+// bucket keys they add, e.g. `text:"lastseen,day"` adds lastseen.day:2026-10-18.
+// Buckets are computed in UTC.
+var timeBuckets = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+	"hour":  "2006-01-02T15",
+}
+
+// formatTime renders t as Unix seconds, which sort numerically and so work with the
+// range terms of Query. The zero time yields "".
+func formatTime(v reflect.Value) string {
+	if !v.CanInterface() {
+		return ""
+	}
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// formatDuration renders a time.Duration as a number of seconds.
+func formatDuration(v reflect.Value) string {
+	return strconv.FormatFloat(time.Duration(v.Int()).Seconds(), 'f', -1, 64)
+}
+
+// timeEmitter returns the emitter for a tagged time.Time field. Besides the Unix seconds
+// key it adds a bucket key for every bucket option in opts. It also reports how many
+// keys a non-zero time produces.
+func timeEmitter(name string, opts []string) (emitter, int) {
+	type bucket struct {
+		prefix string
+		layout string
+	}
+	var buckets []bucket
+	for _, opt := range opts {
+		if layout, ok := timeBuckets[opt]; ok {
+			buckets = append(buckets, bucket{name + "." + opt + ":", layout})
+		}
+	}
+	prefix := name + ":"
+	return func(keys []string, w walker, v reflect.Value) []string {
+		if v = indirect(v); !v.IsValid() || !v.CanInterface() {
+			return keys
+		}
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return keys
+		}
+		keys = append(keys, w.prefix+prefix+strconv.FormatInt(t.Unix(), 10))
+		t = t.UTC()
+		for _, b := range buckets {
+			keys = append(keys, w.prefix+b.prefix+t.Format(b.layout))
+		}
+		return keys
+	}, 1 + len(buckets)
+}
@@ -0,0 +1,218 @@
+package matrixsearch
+
+// Txn groups inserts, updates and deletes so that readers observe either all of them or
+// none. A Txn is only valid inside the function passed to DataStore.Txn or
+// ShardedDataStore.Txn.
+type Txn[T any] struct {
+	ds    *DataStore[T]
+	items map[string]savedItem[T]
+	lists map[string]savedList
+	// events is the number of hook events pending when the transaction started.
+	events int
+	// shards holds one transaction per shard when tx spans a ShardedDataStore, picked by
+	// shardOf. tx itself then holds no changes, and order lists the shard of each hook
+	// event in the order of the writes.
+	shards  []*Txn[T]
+	shardOf func(id string) int
+	order   []int
+}
+
+type savedItem[T any] struct {
+	item    T
+	keys    []string
+	version uint64
+	ok      bool
+}
+
+type savedList struct {
+	ids []string
+	ok  bool
+}
+
+// Txn runs fn while holding the write lock. If fn returns an error or panics, every
+// change made through tx, including posting-list changes, is rolled back. fn must not
+// call methods on ds itself; use tx instead.
+func (ds *DataStore[T]) Txn(fn func(tx *Txn[T]) error) (err error) {
+	ds.mu.Lock()
+	defer ds.writeUnlock()
+	return ds.beginLocked().run(fn)
+}
+
+// run calls fn with tx, rolling tx back if fn returns an error or panics.
+func (tx *Txn[T]) run(fn func(tx *Txn[T]) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tx.rollback()
+			panic(r)
+		}
+	}()
+	if err = fn(tx); err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+// beginLocked starts a transaction on the locked store.
+func (ds *DataStore[T]) beginLocked() *Txn[T] {
+	return &Txn[T]{
+		ds:     ds,
+		items:  make(map[string]savedItem[T]),
+		lists:  make(map[string]savedList),
+		events: len(ds.events),
+	}
+}
+
+// Insert stores item like DataStore.Insert. An ErrDuplicate leaves the transaction
+// unchanged; return it from fn to roll back the rest.
+func (tx *Txn[T]) Insert(item T) error {
+	id := tx.itemID(item)
+	if tx.shards != nil {
+		defer tx.record(id)()
+		return tx.route(id).Insert(item)
+	}
+	holders, err := tx.ds.uniqueHoldersLocked(id, item)
+	if err != nil {
+		return err
+	}
+	comps := tx.ds.combinations(item)
+	for _, other := range holders {
+		tx.save(other, nil)
+	}
+	tx.save(id, comps)
+	return tx.ds.putLocked(id, item, comps)
+}
+
+func (tx *Txn[T]) Update(item T) error {
+	return tx.Insert(item)
+}
+
+func (tx *Txn[T]) Delete(item T) bool {
+	return tx.DeleteByID(tx.itemID(item))
+}
+
+func (tx *Txn[T]) DeleteByID(id string) bool {
+	if tx.shards != nil {
+		defer tx.record(id)()
+		return tx.route(id).DeleteByID(id)
+	}
+	tx.save(id, nil)
+	return tx.ds.deleteLocked(id)
+}
+
+// Get returns the item stored under id, including uncommitted changes made through tx.
+func (tx *Txn[T]) Get(id string) (T, bool) {
+	tx = tx.route(id)
+	item, ok := tx.ds.items[id]
+	return item, ok
+}
+
+func (tx *Txn[T]) Has(id string) bool {
+	tx = tx.route(id)
+	_, ok := tx.ds.items[id]
+	return ok
+}
+
+// Search runs query against the store, including uncommitted changes made through tx.
+func (tx *Txn[T]) Search(query string) []T {
+	if tx.shards != nil {
+		var results []T
+		for _, part := range tx.shards {
+			results = append(results, part.Search(query)...)
+		}
+		return results
+	}
+	return tx.ds.searchLocked(tx.ds.opts.searchKey(query))
+}
+
+// route returns the transaction of the shard owning id, or tx outside a sharded store.
+func (tx *Txn[T]) route(id string) *Txn[T] {
+	if tx.shards == nil {
+		return tx
+	}
+	return tx.shards[tx.shardOf(id)]
+}
+
+// record notes the hook events that the write to id queues on its shard. Call the
+// returned function once the write is done.
+func (tx *Txn[T]) record(id string) func() {
+	i := tx.shardOf(id)
+	ds := tx.shards[i].ds
+	n := len(ds.events)
+	return func() {
+		for ; n < len(ds.events); n++ {
+			tx.order = append(tx.order, i)
+		}
+	}
+}
+
+func (tx *Txn[T]) itemID(item T) string {
+	if tx.shards != nil {
+		return tx.shards[0].itemID(item)
+	}
+	return tx.ds.getID(item)
+}
+
+// save records the state of id and of every posting list it touches the first time
+// the transaction modifies them.
+func (tx *Txn[T]) save(id string, comps []string) {
+	ds := tx.ds
+	if _, ok := tx.items[id]; !ok {
+		item, ok := ds.items[id]
+		tx.items[id] = savedItem[T]{item: item, keys: ds.itemKeys[id], version: ds.versions[id], ok: ok}
+		tx.saveLists(ds.itemKeys[id])
+	}
+	tx.saveLists(comps)
+}
+
+func (tx *Txn[T]) saveLists(keys []string) {
+	for _, key := range keys {
+		if _, ok := tx.lists[key]; !ok {
+			ids, ok := tx.ds.compositeIndex[key]
+			tx.lists[key] = savedList{ids: ids, ok: ok}
+		}
+	}
+}
+
+func (tx *Txn[T]) rollback() {
+	for _, part := range tx.shards {
+		part.rollback()
+	}
+	if tx.shards != nil {
+		tx.order = nil
+		return
+	}
+	ds := tx.ds
+	ds.events = ds.events[:tx.events]
+	for key, l := range tx.lists {
+		if l.ok {
+			ds.compositeIndex[key] = l.ids
+		} else {
+			delete(ds.compositeIndex, key)
+		}
+	}
+	// The secondary indexes are rebuilt from the items: every changed item is removed
+	// before any saved one is put back, so unique values cannot collide.
+	for id := range tx.items {
+		if item, ok := ds.items[id]; ok {
+			ds.unindexSchemaLocked(id, item)
+		}
+	}
+	for id, it := range tx.items {
+		ds.countFieldsLocked(ds.itemKeys[id], -1)
+		ds.countFieldsLocked(it.keys, 1)
+		if it.ok {
+			ds.items[id] = it.item
+			ds.itemKeys[id] = it.keys
+			ds.versions[id] = it.version
+		} else {
+			delete(ds.items, id)
+			delete(ds.itemKeys, id)
+			delete(ds.versions, id)
+		}
+	}
+	for id, it := range tx.items {
+		if it.ok {
+			ds.indexSchemaLocked(id, it.item)
+		}
+	}
+}